@@ -0,0 +1,45 @@
+// Command archcheck checks a Go project against its .codeviz-arch.yml rules file and
+// prints every violation as file:line: message. It exits with status 1 when violations are found.
+//
+//	go run ./cmd/archcheck [-rules path/to/rules.yml] /path/to/project
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"tbd.com/logic"
+)
+
+func main() {
+	rulesPath := flag.String("rules", "", "architecture rules file (default <project>/.codeviz-arch.yml)")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+
+	pm, err := logic.NewPackageManager(filepath.Base(dir), dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "archcheck:", err)
+		os.Exit(2)
+	}
+
+	report, err := pm.CheckArchitecture(*rulesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "archcheck:", err)
+		os.Exit(2)
+	}
+
+	for _, violation := range report.Violations {
+		fmt.Printf("%s:%d: %s [%s]\n", filepath.Join(dir, violation.File), violation.Line, violation.Message, violation.Kind)
+	}
+
+	if len(report.Violations) > 0 {
+		fmt.Fprintf(os.Stderr, "archcheck: %d violation(s)\n", len(report.Violations))
+		os.Exit(1)
+	}
+}
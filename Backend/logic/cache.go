@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"container/list"
+	"sync"
+)
+
+// maxCacheEntries bounds the analyses kept per package. Keys are partly built from request
+// input, so the least recently used analyses are dropped beyond it.
+const maxCacheEntries = 512
+
+// cacheEntry is an analysis along with its key, to find it again when it is evicted
+type cacheEntry struct {
+	key   string
+	value any
+}
+
+// analysisCache memoizes expensive analyses of a package until it is invalidated
+type analysisCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	recent     *list.List // Entries, the most recently used first
+	generation int        // Counts invalidations, so computations started before one are not stored
+}
+
+// newAnalysisCache creates an empty cache
+func newAnalysisCache() *analysisCache {
+	return &analysisCache{
+		entries: make(map[string]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// invalidate drops every cached analysis
+func (c *analysisCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.recent.Init()
+	c.generation++
+}
+
+// lookup returns the analysis stored under key and marks it as used. The caller holds the lock.
+func (c *analysisCache) lookup(key string) (any, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return element.Value.(*cacheEntry).value, true
+}
+
+// store adds an analysis, evicting the least recently used ones beyond maxCacheEntries.
+// The caller holds the lock.
+func (c *analysisCache) store(key string, value any) {
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).value = value
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.recent.PushFront(&cacheEntry{key: key, value: value})
+	for c.recent.Len() > maxCacheEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cached returns the analysis stored under key, computing and storing it on a miss.
+// Failed computations are not cached, and neither are those overtaken by an invalidation.
+func cached[T any](c *analysisCache, key string, compute func() (T, error)) (T, error) {
+	c.mu.Lock()
+	if value, ok := c.lookup(key); ok {
+		c.mu.Unlock()
+		return value.(T), nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	value, err := compute()
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	if c.generation == generation {
+		c.store(key, value)
+	}
+	c.mu.Unlock()
+
+	return value, nil
+}
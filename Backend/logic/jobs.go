@@ -0,0 +1,357 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"tbd.com/utils"
+)
+
+// Job states
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// maxJobEvents is how many of its latest events a job keeps for clients that
+// subscribe late
+const maxJobEvents = 100
+
+// Finished jobs are forgotten once they are older than maxFinishedJobAge, or when more
+// than maxFinishedJobs of them are kept
+const (
+	maxFinishedJobAge = time.Hour
+	maxFinishedJobs   = 50
+)
+
+// JobEvent is a progress update of a background job. Packages are type-checked in a
+// single load, so the load stage stays at 0 percent until every package is loaded and
+// then counts the packages being indexed.
+type JobEvent struct {
+	Stage   string    `json:"stage"` // clone, load or done
+	Message string    `json:"message"`
+	Percent int       `json:"percent"`
+	State   string    `json:"state"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Job is a clone or a package registration running in the background
+type Job struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`   // clone or register
+	Source     string     `json:"source"` // Repo URL or directory
+	State      string     `json:"state"`
+	Package    string     `json:"package,omitempty"`
+	Path       string     `json:"path,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Events     []JobEvent `json:"events"`
+}
+
+// jobResult is what a finished job registered
+type jobResult struct {
+	Package string
+	Path    string
+}
+
+// jobEntry is a job with its cancellation and the channels of its subscribers
+type jobEntry struct {
+	job         Job
+	cancel      context.CancelFunc
+	subscribers map[chan JobEvent]bool
+}
+
+// jobManager runs background jobs and fans their progress out to subscribers
+type jobManager struct {
+	mu   sync.Mutex
+	jobs map[string]*jobEntry
+}
+
+// newJobManager creates a job manager without jobs
+func newJobManager() *jobManager {
+	return &jobManager{
+		jobs: make(map[string]*jobEntry),
+	}
+}
+
+// start runs a job in the background. run reports its progress through report and
+// returns what it registered.
+func (m *jobManager) start(kind, source string, run func(ctx context.Context, report func(JobEvent)) (jobResult, error)) Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &jobEntry{
+		job: Job{
+			ID:        newJobID(),
+			Kind:      kind,
+			Source:    source,
+			State:     JobRunning,
+			CreatedAt: time.Now(),
+			Events:    []JobEvent{},
+		},
+		cancel:      cancel,
+		subscribers: make(map[chan JobEvent]bool),
+	}
+
+	m.mu.Lock()
+	m.prune(time.Now())
+	m.jobs[entry.job.ID] = entry
+	job := entry.copy()
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		result, err := run(ctx, func(event JobEvent) {
+			m.publish(entry, event)
+		})
+		m.finish(entry, result, err, err != nil && ctx.Err() != nil)
+	}()
+
+	return job
+}
+
+// publish records an event of a running job and sends it to its subscribers. Slow
+// subscribers miss progress updates rather than holding up the job.
+func (m *jobManager) publish(entry *jobEntry, event JobEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event.State == "" {
+		event.State = entry.job.State
+	}
+	event.Time = time.Now()
+	entry.job.Events = append(entry.job.Events, event)
+	if len(entry.job.Events) > maxJobEvents {
+		entry.job.Events = entry.job.Events[len(entry.job.Events)-maxJobEvents:]
+	}
+
+	for subscriber := range entry.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// finish records the outcome of a job and closes the channels of its subscribers
+func (m *jobManager) finish(entry *jobEntry, result jobResult, err error, canceled bool) {
+	event := JobEvent{Stage: "done", Percent: 100}
+	switch {
+	case canceled:
+		event.State, event.Message = JobCanceled, "Canceled"
+	case err != nil:
+		event.State, event.Message, event.Error = JobFailed, "Failed", err.Error()
+	default:
+		event.State, event.Message = JobSucceeded, "Registered "+result.Package
+	}
+
+	m.mu.Lock()
+	entry.job.State = event.State
+	entry.job.Error = event.Error
+	entry.job.Package = result.Package
+	entry.job.Path = result.Path
+	finishedAt := time.Now()
+	entry.job.FinishedAt = &finishedAt
+	m.mu.Unlock()
+
+	m.publish(entry, event)
+
+	m.mu.Lock()
+	for subscriber := range entry.subscribers {
+		close(subscriber)
+	}
+	entry.subscribers = nil
+	m.prune(finishedAt)
+	m.mu.Unlock()
+}
+
+// prune forgets the finished jobs that are too old and the oldest ones beyond
+// maxFinishedJobs. Running jobs are always kept. The caller holds the lock.
+func (m *jobManager) prune(now time.Time) {
+	finished := []*jobEntry{}
+	for id, entry := range m.jobs {
+		if entry.job.FinishedAt == nil {
+			continue
+		}
+		if now.Sub(*entry.job.FinishedAt) > maxFinishedJobAge {
+			delete(m.jobs, id)
+			continue
+		}
+		finished = append(finished, entry)
+	}
+
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].job.FinishedAt.After(*finished[j].job.FinishedAt)
+	})
+	for _, entry := range finished[maxFinishedJobs:] {
+		delete(m.jobs, entry.job.ID)
+	}
+}
+
+// get returns a job
+func (m *jobManager) get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+	entry, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errors.New("unknown job")
+	}
+	return entry.copy(), nil
+}
+
+// list returns every job, the latest first
+func (m *jobManager) list() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, entry := range m.jobs {
+		jobs = append(jobs, entry.copy())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// cancel stops a running job. The job reports its cancellation once it has cleaned up.
+func (m *jobManager) cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.jobs[id]
+	if !ok {
+		return Job{}, errors.New("unknown job")
+	}
+	if entry.job.State != JobRunning {
+		return Job{}, fmt.Errorf("job already %s", entry.job.State)
+	}
+	entry.cancel()
+	return entry.copy(), nil
+}
+
+// subscribe returns a job and a channel receiving its following events. The channel is
+// closed when the job finishes and is nil if it already has.
+func (m *jobManager) subscribe(id string) (Job, chan JobEvent, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, errors.New("unknown job")
+	}
+	if entry.subscribers == nil {
+		return entry.copy(), nil, func() {}, nil
+	}
+
+	events := make(chan JobEvent, 64)
+	entry.subscribers[events] = true
+	unsubscribe := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if entry.subscribers[events] {
+			delete(entry.subscribers, events)
+			close(events)
+		}
+	}
+	return entry.copy(), events, unsubscribe, nil
+}
+
+// copy returns the job with its own slice of events
+func (e *jobEntry) copy() Job {
+	job := e.job
+	job.Events = append([]JobEvent{}, e.job.Events...)
+	return job
+}
+
+// newJobID returns a random job ID
+func newJobID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// StartCloneJob clones a repo and registers a folder inside it in the background
+func (p *PackageHandler) StartCloneJob(repoURL, folderName string, options utils.CloneOptions) (Job, error) {
+	if _, err := utils.ParseRemoteURL(repoURL); err != nil {
+		return Job{}, err
+	}
+
+	// Jobs are listed to every client, so they never show credentials
+	source := utils.RedactURL(repoURL)
+	return p.jobs.start("clone", source, func(ctx context.Context, report func(JobEvent)) (jobResult, error) {
+		report(JobEvent{Stage: "clone", Message: "Cloning " + source})
+		path, err := p.cloneRepoContext(ctx, repoURL, options, func(progress utils.CloneProgress) {
+			report(JobEvent{Stage: "clone", Message: progress.Stage, Percent: progress.Percent})
+		})
+		if err != nil {
+			return jobResult{}, err
+		}
+
+		filePath, name := clonedPackage(path, folderName)
+		return p.registerForJob(ctx, filePath, name, repoURL, &options, report)
+	}), nil
+}
+
+// StartRegisterJob registers a local directory as a package in the background
+func (p *PackageHandler) StartRegisterJob(filePath, name string) (Job, error) {
+	if _, err := os.Stat(filePath); err != nil {
+		return Job{}, err
+	}
+
+	return p.jobs.start("register", filePath, func(ctx context.Context, report func(JobEvent)) (jobResult, error) {
+		return p.registerForJob(ctx, filePath, name, "", nil, report)
+	}), nil
+}
+
+// registerForJob loads a package for a job, reporting the Go packages loaded
+func (p *PackageHandler) registerForJob(ctx context.Context, filePath, name, originURL string, settings *utils.CloneOptions, report func(JobEvent)) (jobResult, error) {
+	report(JobEvent{Stage: "load", Message: "Loading packages"})
+	_, err := p.addPackageContext(ctx, filePath, name, originURL, settings, func(loaded, total int) {
+		report(JobEvent{
+			Stage:   "load",
+			Message: fmt.Sprintf("Loaded %d of %d packages", loaded, total),
+			Percent: loaded * 100 / total,
+		})
+	})
+	if err != nil {
+		return jobResult{}, err
+	}
+	return jobResult{Package: name, Path: filePath}, nil
+}
+
+// GetJob returns a background job
+func (p *PackageHandler) GetJob(id string) (Job, error) {
+	return p.jobs.get(id)
+}
+
+// GetJobs lists the background jobs, the latest first
+func (p *PackageHandler) GetJobs() []Job {
+	return p.jobs.list()
+}
+
+// CancelJob stops a running background job
+func (p *PackageHandler) CancelJob(id string) (Job, error) {
+	return p.jobs.cancel(id)
+}
+
+// SubscribeJob returns a job and a channel of its following events
+func (p *PackageHandler) SubscribeJob(id string) (Job, chan JobEvent, func(), error) {
+	return p.jobs.subscribe(id)
+}
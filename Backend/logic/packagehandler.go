@@ -1,29 +1,115 @@
 package logic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"tbd.com/utils"
 )
 
-// PackageHandler
+// clonesDir is the directory, relative to the working directory, that repos are cloned into
+const clonesDir = "repos"
+
+// PackageHandler keeps track of the registered packages. It is safe for concurrent use.
 type PackageHandler struct {
-	packages map[string]PackageManager
+	mu       sync.RWMutex
+	packages map[string]*packageEntry
+	jobs     *jobManager
+	registry *packageRegistry
+	changes  *changeFeed
+
+	snapshotUses map[string]time.Time // When each loaded snapshot was last requested
+	maxSnapshots int
+
+	cloning map[string]chan struct{} // Clone folders being written, closed once done
+}
+
+// NewPackageHandler restores the packages of the registry file, loading them right away
+// or on their first request depending on the restore mode. The directories of the loaded
+// packages are watched for changes if a watch interval is configured.
+func NewPackageHandler() *PackageHandler {
+	registryPath, restoreMode := registryConfig()
+	registry, err := loadRegistry(registryPath)
+	if err != nil {
+		// Keep the unreadable file rather than overwriting it
+		fmt.Println("Warning: package registry disabled:", err)
+		registry, _ = loadRegistry("")
+	}
+
+	p := &PackageHandler{
+		packages: make(map[string]*packageEntry),
+		jobs:     newJobManager(),
+		registry: registry,
+		changes:  newChangeFeed(),
+
+		snapshotUses: make(map[string]time.Time),
+		maxSnapshots: snapshotLimit(),
+
+		cloning: make(map[string]chan struct{}),
+	}
+	removeSnapshotWorktrees(registry.list())
+
+	if restoreMode == RestoreEager {
+		for _, registration := range registry.list() {
+			if _, err := p.get(registration.Name); err != nil {
+				fmt.Println("Warning:", err)
+			}
+		}
+	}
+
+	if interval := watchInterval(); interval > 0 {
+		go p.watch(interval)
+	}
+
+	return p
 }
 
-// NewPackageHandler
-func NewPackageHandler() PackageHandler {
-	return PackageHandler{
-		packages: make(map[string]PackageManager),
+// get returns a package, loading it first if it is registered but was not loaded yet.
+// Requests for a package that is still loading wait for it.
+func (p *PackageHandler) get(name string) (PackageManager, error) {
+	if entry, ok := p.lookup(name); ok {
+		return p.wait(entry)
+	}
+
+	registration, ok := p.registry.lookup(name)
+	if !ok {
+		return PackageManager{}, errors.New("unknown package")
 	}
+
+	return p.loadOnce(name, registration.Path, func() (PackageManager, error) {
+		pm, err := NewPackageManager(name, registration.Path)
+		if err != nil {
+			return PackageManager{}, fmt.Errorf("failed to restore package %s: %w", name, err)
+		}
+		return pm, nil
+	})
 }
 
 // addPackage
-func (p PackageHandler) addPackage(filePath, name string) (string, error) {
+func (p *PackageHandler) addPackage(filePath, name string) (string, error) {
+	return p.addPackageContext(context.Background(), filePath, name, "", nil, nil)
+}
+
+// addClonedPackage registers a package inside a clone along with where it was cloned from
+func (p *PackageHandler) addClonedPackage(filePath, name, repoURL string, options utils.CloneOptions) (string, error) {
+	return p.addPackageContext(context.Background(), filePath, name, repoURL, &options, nil)
+}
+
+// addPackageContext registers a package like addPackage and stores it in the registry with
+// its origin and clone settings. How many Go packages were loaded is reported to progress
+// if it is set, and loading stops when ctx is canceled.
+func (p *PackageHandler) addPackageContext(ctx context.Context, filePath, name, originURL string, settings *utils.CloneOptions, progress func(loaded, total int)) (string, error) {
+	// Snapshots are named after their package and commit, separated by @
+	if strings.Contains(name, "@") {
+		return "", fmt.Errorf("package name %s cannot contain @", name)
+	}
 
 	// Validate the file path to prevent directory traversal attacks
 	cleanPath := filepath.Clean(filePath)
@@ -42,117 +128,637 @@ func (p PackageHandler) addPackage(filePath, name string) (string, error) {
 		return "", errors.New("path is a file, not a directory file")
 	}
 
-	if _, ok := p.packages[name]; ok {
+	// Registering the same directory again is a no-op, but a name stays bound to its directory
+	absPath, err := filepath.Abs(cleanPath)
+	if err != nil {
+		return "", err
+	}
+	if registeredPath, ok := p.registeredPath(name); ok {
+		if registeredPath != absPath {
+			return "", fmt.Errorf("package name %s already in use for %s", name, registeredPath)
+		}
 		return "Success", nil
-		// return "", errors.New("package name already in use. give another name")
 	}
 
-	pm, err := NewPackageManager(name, cleanPath)
+	pm, err := p.loadOnce(name, absPath, func() (PackageManager, error) {
+		return NewPackageManagerContext(ctx, name, cleanPath, progress)
+	})
 	if err != nil {
 		return "", err
 	}
+	// A concurrent registration of the name may have won
+	if pm.dirPath != absPath {
+		return "", fmt.Errorf("package name %s already in use for %s", name, pm.dirPath)
+	}
 
-	p.packages[name] = pm
+	if err := p.registry.add(newRegistration(name, pm.dirPath, originURL, settings)); err != nil {
+		fmt.Println("Warning: package not persisted:", err)
+	}
+	if settings != nil {
+		p.registry.setToken(name, settings.Token)
+	}
 
 	return "Success", nil
 }
 
+// isClone reports whether a directory lies inside the clones directory
+func isClone(dirPath string) bool {
+	clones, err := filepath.Abs(clonesDir)
+	if err != nil {
+		return false
+	}
+	return isWithin(clones, dirPath) && filepath.Clean(dirPath) != clones
+}
+
+// isWithin reports whether a path is dir or lies below it
+func isWithin(dir, path string) bool {
+	relPath, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// registeredPath returns the directory of a loaded or registered package
+func (p *PackageHandler) registeredPath(name string) (string, bool) {
+	if entry, ok := p.lookup(name); ok {
+		p.mu.RLock()
+		defer p.mu.RUnlock()
+		return entry.path, true
+	}
+	if registration, ok := p.registry.lookup(name); ok {
+		return registration.Path, true
+	}
+	return "", false
+}
+
 // GetTreeStructure
-func (p PackageHandler) GetTreeStructure(name string, depth int) (DirectoryInfo, error) {
-	if _, ok := p.packages[name]; !ok {
-		return DirectoryInfo{}, errors.New("unknown package")
+func (p *PackageHandler) GetTreeStructure(name string, depth int) (DirectoryInfo, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return DirectoryInfo{}, err
 	}
-	return p.packages[name].GetTreeStructure(depth), nil
+	return pm.GetTreeStructure(depth), nil
 }
 
 // GetGitStats
-func (p PackageHandler) GetGitStats(name string) (utils.GitStats, error) {
-	if _, ok := p.packages[name]; !ok {
-		return utils.GitStats{}, errors.New("unknown package")
+func (p *PackageHandler) GetGitStats(name string) (utils.GitStats, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.GitStats{}, err
 	}
-	return p.packages[name].GetGitStats(), nil
+	return pm.GetGitStats(), nil
 }
 
 // GetLintIssues
-func (p PackageHandler) GetLintIssues(name string) (utils.LintIssues, error) {
-	if _, ok := p.packages[name]; !ok {
-		return utils.LintIssues{}, errors.New("unknown package")
+func (p *PackageHandler) GetLintIssues(name string) (utils.LintIssues, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.LintIssues{}, err
 	}
-	return p.packages[name].GetLintIssues()
+	return pm.GetLintIssues()
 }
 
 // FindFunctions
-func (p PackageHandler) FindFunctions(name, path string) ([]string, error) {
-	if _, ok := p.packages[name]; !ok {
-		return nil, errors.New("unknown package")
+func (p *PackageHandler) FindFunctions(name, path string) ([]string, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return nil, err
 	}
-	return p.packages[name].FindFunctions(path)
+	return pm.FindFunctions(path)
 }
 
 // GetFileContributions
-func (p PackageHandler) GetFileContributions(name, filePath string) ([]utils.FileContributor, error) {
-	if _, ok := p.packages[name]; !ok {
-		return nil, errors.New("unknown package")
+func (p *PackageHandler) GetFileContributions(name, filePath string) ([]utils.FileContributor, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return nil, err
 	}
-	return p.packages[name].GetFileContributions(filePath)
+	return pm.GetFileContributions(filePath)
 }
 
 // GetFileContent
-func (p PackageHandler) GetFileContent(name, filePath string) (string, error) {
-	if _, ok := p.packages[name]; !ok {
-		return "", errors.New("unknown package")
+func (p *PackageHandler) GetFileContent(name, filePath string) (string, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return "", err
 	}
-	return p.packages[name].GetFileContent(filePath)
+	return pm.GetFileContent(filePath)
 }
 
 // GetFileContent
-func (p PackageHandler) GetCodeFlow(name, path, function string) (*utils.FunctionNode, error) {
-	if _, ok := p.packages[name]; !ok {
-		return nil, errors.New("unknown package")
+func (p *PackageHandler) GetCodeFlow(name, path, function string) (*utils.FunctionNode, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return pm.GetCodeFlow(path, function)
+}
+
+// clonedPackage returns the directory and the package name of a folder inside a clone.
+// The name is made of the owner path and the repo name, leaving out the host.
+func clonedPackage(packDir, folderName string) (string, string) {
+	name := filepath.Base(filepath.Clean(packDir))
+	if rel, err := filepath.Rel(clonesDir, packDir); err == nil {
+		if parts := strings.Split(filepath.ToSlash(rel), "/"); len(parts) > 1 {
+			name = strings.Join(parts[1:], "-")
+		}
 	}
-	return p.packages[name].GetCodeFlow(path, function)
+	return filepath.Join(packDir, folderName), name + "-" + folderName
+}
+
+// CloneRepo clones a repo into a local directory named after its host, owner and repo
+// name. If the folder already holds a clone of the same repo, it is reused as long as
+// the options do not ask for another checkout.
+func (p *PackageHandler) CloneRepo(repoURL string, options utils.CloneOptions) (string, error) {
+	return p.cloneRepoContext(context.Background(), repoURL, options, nil)
 }
 
-// CloneRepo clones a GitHub repo into a local directory named after the username and repo name.
-// If the folder already exists, it assumes it's already cloned and returns successfully.
-func (p PackageHandler) CloneRepo(repoURL string) (string, error) {
+// cloneRepoContext clones like CloneRepo, reporting the progress of git to progress if it
+// is set. The clone is aborted when ctx is canceled.
+func (p *PackageHandler) cloneRepoContext(ctx context.Context, repoURL string, options utils.CloneOptions, progress func(utils.CloneProgress)) (string, error) {
 	// Get present working directory
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", err
 	}
 
-	// Extract username and repo name from URL
-	trimmedURL := strings.TrimSuffix(repoURL, "/")
-	parts := strings.Split(trimmedURL, "/")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("invalid repo URL: %s", repoURL)
+	remote, err := utils.ParseRemoteURL(repoURL)
+	if err != nil {
+		return "", err
 	}
-	username := parts[len(parts)-2]
-	repoName := parts[len(parts)-1]
 
 	// Create folder name
-	folderName := username + "-" + repoName
-	packDir := filepath.Join("repos", folderName)
+	packDir := filepath.Join(clonesDir, remote.FolderName())
 
-	if _, err := os.Stat(packDir); err == nil {
+	release, claimed, err := p.claimCloneDir(ctx, packDir)
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
 		// Directory already exists, no need to clone
+		if err := checkExistingClone(packDir, remote, options); err != nil {
+			return "", err
+		}
 		return packDir, nil
 	}
+	defer release()
 
 	// Create the directory
 	if err := os.MkdirAll(packDir, os.ModePerm); err != nil {
 		return "", err
 	}
 
-	// Clone the repository
-	return packDir, utils.CloneRepo(repoURL, filepath.Join(cwd, packDir))
+	// Clone the repository, leaving nothing behind on failure so it can be retried
+	if err := utils.CloneRepoContext(ctx, repoURL, filepath.Join(cwd, packDir), options, progress); err != nil {
+		os.RemoveAll(packDir)
+		return "", err
+	}
+	return packDir, nil
+}
+
+// claimCloneDir reserves a clone folder that does not exist yet. A folder that another
+// clone is writing is waited for, so it is never used half cloned nor removed from under
+// another clone that failed. claimed is false if the folder already exists; otherwise
+// release must be called once the clone is done.
+func (p *PackageHandler) claimCloneDir(ctx context.Context, packDir string) (func(), bool, error) {
+	for {
+		p.mu.Lock()
+		inFlight, busy := p.cloning[packDir]
+		if !busy {
+			break
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-inFlight:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	defer p.mu.Unlock()
+
+	if _, err := os.Stat(packDir); err == nil {
+		return nil, false, nil
+	}
+	done := make(chan struct{})
+	p.cloning[packDir] = done
+	release := func() {
+		p.mu.Lock()
+		delete(p.cloning, packDir)
+		p.mu.Unlock()
+		close(done)
+	}
+	return release, true, nil
+}
+
+// checkExistingClone makes sure a clone can be reused for a remote: it must have been
+// cloned from the same repo, and the options cannot ask for a checkout that only a new
+// clone would give
+func checkExistingClone(packDir string, remote utils.RemoteURL, options utils.CloneOptions) error {
+	originURL, err := utils.OriginURL(packDir)
+	if err != nil {
+		return fmt.Errorf("%s already exists and is not a clone of %s", packDir, utils.RedactURL(remote.Raw))
+	}
+	origin, err := utils.ParseRemoteURL(originURL)
+	if err != nil || !origin.SameRepo(remote) {
+		return fmt.Errorf("%s already exists and is not a clone of %s", packDir, utils.RedactURL(remote.Raw))
+	}
+
+	if options.Depth > 0 || len(options.SparsePaths) > 0 || options.Submodules {
+		return fmt.Errorf("%s is already cloned into %s, remove it to clone it with other options", utils.RedactURL(remote.Raw), packDir)
+	}
+	if options.Branch == "" {
+		return nil
+	}
+	// Tags are checked out detached, so they are compared by commit
+	if ref, err := utils.CurrentRef(packDir); err == nil && ref == options.Branch {
+		return nil
+	}
+	head, headErr := utils.ResolveRef(packDir, "HEAD")
+	target, targetErr := utils.ResolveRef(packDir, options.Branch)
+	if headErr != nil || targetErr != nil || head != target {
+		return fmt.Errorf("%s is already cloned into %s, refresh it to check out %s", utils.RedactURL(remote.Raw), packDir, options.Branch)
+	}
+	return nil
 }
 
 // GetCodeCoverage retrieves code coverage stats for the package
-func (p PackageHandler) GetCodeCoverage(name, path string) (utils.CoverageStats, error) {
-	if _, ok := p.packages[name]; !ok {
-		return utils.CoverageStats{}, errors.New("unknown package")
+func (p *PackageHandler) GetCodeCoverage(name, path string) (utils.CoverageStats, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.CoverageStats{}, err
+	}
+	return pm.GetCodeCoverage(path)
+}
+
+// GetCallGraphDiff compares the call graphs of the package at two git refs
+func (p *PackageHandler) GetCallGraphDiff(name, baseRef, headRef string) (utils.CallGraphDiff, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.CallGraphDiff{}, err
+	}
+	return pm.GetCallGraphDiff(baseRef, headRef)
+}
+
+// CheckArchitecture evaluates the package's architecture rules file
+func (p *PackageHandler) CheckArchitecture(name string) (utils.ArchReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.ArchReport{}, err
+	}
+	return pm.CheckArchitecture("")
+}
+
+// GetAPISurface lists the exported API of the package
+func (p *PackageHandler) GetAPISurface(name string) ([]utils.APIElement, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return pm.GetAPISurface(), nil
+}
+
+// GetAPIDiff compares the package's exported API between two git refs, or between a ref
+// and the loaded package
+func (p *PackageHandler) GetAPIDiff(name, baseRef, headRef string) (utils.APIDiff, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.APIDiff{}, err
+	}
+	return pm.GetAPIDiff(baseRef, headRef)
+}
+
+// GetFieldUsage lists where the fields of a struct type are read and written
+func (p *PackageHandler) GetFieldUsage(name, typeName string) (utils.StructFieldUsage, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.StructFieldUsage{}, err
+	}
+	return pm.GetFieldUsage(typeName)
+}
+
+// GetDesignMetrics computes the design metrics of the package
+func (p *PackageHandler) GetDesignMetrics(name string) (utils.DesignMetrics, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.DesignMetrics{}, err
+	}
+	return pm.GetDesignMetrics(), nil
+}
+
+// GetClones detects duplicated code in the package
+func (p *PackageHandler) GetClones(name string, minLines int) (utils.CloneReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.CloneReport{}, err
+	}
+	return pm.GetClones(minLines)
+}
+
+// GetHotspots ranks the package's code by churn and complexity
+func (p *PackageHandler) GetHotspots(name, since string) (utils.HotspotReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.HotspotReport{}, err
+	}
+	return pm.GetHotspots(since)
+}
+
+// GetFunctionOwnership computes the ownership of the package's functions
+func (p *PackageHandler) GetFunctionOwnership(name, filePath string) ([]utils.FunctionOwner, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return pm.GetFunctionOwnership(filePath)
+}
+
+// GetFunctionHistory returns the commit history of a function of the package
+func (p *PackageHandler) GetFunctionHistory(name, filePath, functionName string) (utils.FunctionHistory, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.FunctionHistory{}, err
+	}
+	return pm.GetFunctionHistory(filePath, functionName)
+}
+
+// GetBlame returns the line-level blame of a file of the package
+func (p *PackageHandler) GetBlame(name, filePath, ignoreRevsFile string) (utils.FileBlame, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.FileBlame{}, err
+	}
+	return pm.GetBlame(filePath, ignoreRevsFile)
+}
+
+// GetCommitLog returns a page of the package's commit history
+func (p *PackageHandler) GetCommitLog(name, cursor string, limit int, filter utils.CommitFilter) (utils.CommitPage, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.CommitPage{}, err
+	}
+	return pm.GetCommitLog(cursor, limit, filter)
+}
+
+// GetCommitDetail returns the details and structured diff of a commit of the package
+func (p *PackageHandler) GetCommitDetail(name, ref string) (utils.CommitDetail, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.CommitDetail{}, err
+	}
+	return pm.GetCommitDetail(ref)
+}
+
+// ResolvePackage returns the name of the package to analyze at a git ref. An empty ref
+// selects the package itself; any other ref selects a snapshot of the package at the
+// commit the ref points to, which is loaded on first use. Only the most recently used
+// snapshots stay loaded.
+func (p *PackageHandler) ResolvePackage(name, ref string) (string, error) {
+	if ref == "" {
+		return name, nil
 	}
-	return p.packages[name].GetCodeCoverage(path)
+
+	// Refs of a snapshot are resolved against the package it was taken from, whose
+	// name is followed by the last @ and the snapshot's commit
+	base := name
+	if at := strings.LastIndex(name, "@"); at >= 0 {
+		base = name[:at]
+	}
+	pm, err := p.get(base)
+	if err != nil {
+		return "", err
+	}
+
+	commit, err := utils.ResolveRef(pm.dirPath, ref)
+	if err != nil {
+		return "", err
+	}
+
+	// Concurrent requests for the same commit share one snapshot
+	snapshotName := base + "@" + commit
+	if _, err := p.loadOnce(snapshotName, "", func() (PackageManager, error) {
+		return pm.Snapshot(commit)
+	}); err != nil {
+		return "", err
+	}
+	p.useSnapshot(snapshotName)
+
+	return snapshotName, nil
+}
+
+// GetRefs lists the branches and tags of the package's repository
+func (p *PackageHandler) GetRefs(name string) ([]utils.GitRef, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return nil, err
+	}
+	return pm.GetRefs()
+}
+
+// GetIdentities lists the unified contributors of the package
+func (p *PackageHandler) GetIdentities(name string) (utils.IdentityReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.IdentityReport{}, err
+	}
+	return pm.GetIdentities()
+}
+
+// GetActivity returns the commit activity of the package
+func (p *PackageHandler) GetActivity(name, granularity string, filter utils.ActivityFilter) (utils.ActivityReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.ActivityReport{}, err
+	}
+	return pm.GetActivity(granularity, filter)
+}
+
+// GetChangeCoupling finds the files and functions of the package that change together
+func (p *PackageHandler) GetChangeCoupling(name, since string, minSupport int, minStrength float64) (utils.CouplingReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.CouplingReport{}, err
+	}
+	return pm.GetChangeCoupling(since, minSupport, minStrength)
+}
+
+// GetBusFactor computes the bus factor tree of the package
+func (p *PackageHandler) GetBusFactor(name string, depth, staleDays int) (BusFactorInfo, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return BusFactorInfo{}, err
+	}
+	return pm.GetBusFactor(depth, staleDays)
+}
+
+// GetLineCounts counts the lines of the package by language, directory and file
+func (p *PackageHandler) GetLineCounts(name string) (utils.LineCountReport, error) {
+	pm, err := p.get(name)
+	if err != nil {
+		return utils.LineCountReport{}, err
+	}
+	return pm.GetLineCounts()
+}
+
+// Refresh updates the clone of the package from its remote and replaces the package
+// with a freshly loaded one. Only clones in the clones directory can be refreshed, so
+// checkouts registered from elsewhere on the machine are never moved. Tokens are not
+// persisted, so a token given here is remembered once it worked.
+func (p *PackageHandler) Refresh(name, ref, token string) (utils.RepoUpdate, error) {
+	if _, err := p.get(name); err != nil {
+		return utils.RepoUpdate{}, err
+	}
+	registration, ok := p.registry.lookup(name)
+	if !ok || !isClone(registration.Path) {
+		return utils.RepoUpdate{}, fmt.Errorf("only packages cloned into %s can be refreshed", clonesDir)
+	}
+	options := p.registry.cloneOptions(name)
+	if token != "" {
+		options.Token = token
+	}
+
+	var update utils.RepoUpdate
+	refreshed, err := p.reloadOnce(name, func(previous PackageManager, _ string) (PackageManager, error) {
+		var refreshed PackageManager
+		var err error
+		update, refreshed, err = previous.Refresh(ref, options)
+		return refreshed, err
+	})
+	if err != nil {
+		return update, err
+	}
+
+	if token != "" {
+		p.registry.setToken(name, token)
+	}
+
+	// The registry follows the ref the clone moved to
+	if registration, ok := p.registry.lookup(name); ok {
+		registration.Ref, _ = utils.CurrentRef(refreshed.dirPath)
+		if err := p.registry.add(registration); err != nil {
+			fmt.Println("Warning: package not persisted:", err)
+		}
+	}
+
+	return update, nil
+}
+
+// ListPackages describes every registered package and loaded snapshot, sorted by name
+func (p *PackageHandler) ListPackages() []PackageInfo {
+	names := make(map[string]bool)
+	for _, registration := range p.registry.list() {
+		names[registration.Name] = true
+	}
+	p.mu.RLock()
+	for name := range p.packages {
+		names[name] = true
+	}
+	p.mu.RUnlock()
+
+	infos := []PackageInfo{}
+	for name := range names {
+		infos = append(infos, p.packageInfo(name))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// GetPackage describes a registered package without loading it
+func (p *PackageHandler) GetPackage(name string) (PackageInfo, error) {
+	if _, ok := p.registeredPath(name); !ok {
+		return PackageInfo{}, errors.New("unknown package")
+	}
+	return p.packageInfo(name), nil
+}
+
+// packageInfo describes a loaded or registered package and its load state
+func (p *PackageHandler) packageInfo(name string) PackageInfo {
+	info := PackageInfo{Name: name, Status: PackageUnloaded, LoadErrors: []string{}}
+
+	p.mu.RLock()
+	if entry, ok := p.packages[name]; ok {
+		switch entry.state {
+		case PackageReady, PackageReloading:
+			info = entry.pm.Info()
+		case PackageFailed:
+			info.LoadErrors = []string{entry.err.Error()}
+		}
+		info.Status = entry.state
+		info.Path = entry.path
+	}
+	p.mu.RUnlock()
+
+	if registration, ok := p.registry.lookup(name); ok {
+		info.Path = registration.Path
+		info.OriginURL = utils.RedactURL(registration.OriginURL)
+		info.Ref = registration.Ref
+	}
+	return info
+}
+
+// ReloadPackage loads a registered package again from its directory, dropping every
+// cached analysis of it. A reload requested while another one runs waits for that one.
+func (p *PackageHandler) ReloadPackage(name string) (PackageInfo, error) {
+	// Packages that were never requested are simply loaded now
+	if _, ok := p.lookup(name); !ok {
+		if _, err := p.get(name); err != nil {
+			return PackageInfo{}, err
+		}
+		return p.packageInfo(name), nil
+	}
+
+	_, err := p.reloadOnce(name, func(previous PackageManager, path string) (PackageManager, error) {
+		if previous.ca == nil {
+			return NewPackageManager(name, path)
+		}
+		return previous.Reload()
+	})
+	if errors.Is(err, errPackageBusy) {
+		if entry, ok := p.lookup(name); ok {
+			p.settle(entry)
+		}
+		err = nil
+	}
+	if err != nil {
+		return PackageInfo{}, err
+	}
+
+	return p.packageInfo(name), nil
+}
+
+// RemovePackage unregisters a package along with its snapshots. The package's files
+// are left untouched.
+func (p *PackageHandler) RemovePackage(name string) error {
+	if _, ok := p.registeredPath(name); !ok {
+		return errors.New("unknown package")
+	}
+
+	// Unregister under the handler lock, so a concurrent request cannot load the package again
+	p.mu.Lock()
+	err := p.registry.remove(name)
+	removed := []*packageEntry{}
+	for loadedName, entry := range p.packages {
+		if loadedName == name || strings.HasPrefix(loadedName, name+"@") {
+			removed = append(removed, entry)
+			delete(p.packages, loadedName)
+			delete(p.snapshotUses, loadedName)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, entry := range removed {
+		p.settle(entry)
+		if entry.pm.cache == nil {
+			continue
+		}
+		entry.pm.cache.invalidate()
+		if entry.pm.origin != "" {
+			entry.pm.removeSnapshot()
+		}
+	}
+
+	return err
 }
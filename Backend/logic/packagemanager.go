@@ -1,11 +1,14 @@
 package logic
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"tbd.com/utils"
 )
@@ -45,30 +48,131 @@ type PackageManager struct {
 	dirPath     string
 	ProjectInfo utils.GoProjectInfo
 	ca          *utils.CallGraphAnalyzer
+	cache       *analysisCache
+	origin      string // Directory of the package a snapshot was taken from
+	worktree    string // Worktree a snapshot was checked out into
+
+	loadedAt     time.Time
+	loadDuration time.Duration
+	memoryBytes  uint64                     // Estimated memory held by the loaded packages
+	stamps       map[string]utils.FileStamp // Source files as they were when loading started
+}
+
+// PackageInfo describes a registered package and how it was loaded
+type PackageInfo struct {
+	Name                 string               `json:"name"`
+	Path                 string               `json:"path"`
+	OriginURL            string               `json:"originURL,omitempty"`
+	Ref                  string               `json:"ref,omitempty"`
+	SnapshotOf           string               `json:"snapshotOf,omitempty"`
+	Status               string               `json:"status"`
+	LoadedAt             *time.Time           `json:"loadedAt,omitempty"`
+	LoadMillis           int64                `json:"loadMillis"`
+	PackageCount         int                  `json:"packageCount"`
+	LoadErrors           []string             `json:"loadErrors"`
+	EstimatedMemoryBytes uint64               `json:"estimatedMemoryBytes"` // Derived from the loaded sources, not measured
+	ProjectInfo          *utils.GoProjectInfo `json:"projectInfo,omitempty"`
 }
 
 // DirectoryInfo represents structure of a directory or file
 type DirectoryInfo struct {
-	Name     string          `json:"name"`
-	Path     string          `json:"path"`
-	IsDir    bool            `json:"isDir"`
-	Children []DirectoryInfo `json:"children,omitempty"`
+	Name         string          `json:"name"`
+	Path         string          `json:"path"`
+	IsDir        bool            `json:"isDir"`
+	DuplicatePct float64         `json:"duplicatePercentage,omitempty"`
+	Children     []DirectoryInfo `json:"children,omitempty"`
+}
+
+// BusFactorInfo represents the knowledge distribution of a directory or file
+type BusFactorInfo struct {
+	Name       string                 `json:"name"`
+	Path       string                 `json:"path"`
+	IsDir      bool                   `json:"isDir"`
+	Lines      int                    `json:"lines"`
+	BusFactor  int                    `json:"busFactor"`
+	MainAuthor string                 `json:"mainAuthor,omitempty"`
+	Stale      bool                   `json:"stale"` // The main author has not committed recently
+	Authors    []utils.KnowledgeShare `json:"authors"`
+	Children   []BusFactorInfo        `json:"children,omitempty"`
+}
+
+// busFactorContext holds what every level of the bus factor tree needs
+type busFactorContext struct {
+	tracked     map[string]bool
+	lastCommits map[string]time.Time
+	staleBefore time.Time
+	rules       utils.IdentityRules
 }
 
 // NewPackageManager
 func NewPackageManager(name, dirPath string) (PackageManager, error) {
+	return NewPackageManagerContext(context.Background(), name, dirPath, nil)
+}
+
+// NewPackageManagerContext loads a package like NewPackageManager, reporting how many Go
+// packages were loaded to progress if it is set. Loading stops when ctx is canceled.
+func NewPackageManagerContext(ctx context.Context, name, dirPath string, progress func(loaded, total int)) (PackageManager, error) {
 	var err error
 	projectInfo := utils.ValidateGoProject(dirPath)
 	if !projectInfo.IsGoProject {
 		return PackageManager{}, errors.New("not a go project")
 	}
-	ca := utils.NewCallGraphAnalyzer(dirPath)
 
 	dirPath, err = filepath.Abs(dirPath)
 	if err != nil {
-		return PackageManager{}, fmt.Errorf("Error : ", err)
+		return PackageManager{}, fmt.Errorf("Error : %v", err)
+	}
+
+	pm := PackageManager{
+		name:        name,
+		dirPath:     dirPath,
+		ProjectInfo: projectInfo,
+	}
+
+	// Files edited while loading differ from these stamps, so the watcher picks them up
+	pm.stamps, _ = pm.scanSourceFiles()
+
+	start := time.Now()
+	ca, err := loadCallGraphContext(ctx, dirPath, progress)
+	if err != nil {
+		return PackageManager{}, err
 	}
 
+	pm.ca = ca
+	pm.cache = newAnalysisCache()
+	pm.loadedAt = time.Now()
+	pm.loadDuration = time.Since(start)
+	pm.memoryBytes = ca.EstimatedMemory()
+	return pm, nil
+}
+
+// scanSourceFiles stamps the package's Go source and module files, leaving out the
+// ignored ones
+func (p PackageManager) scanSourceFiles() (map[string]utils.FileStamp, error) {
+	return utils.ScanSourceFiles(p.dirPath, func(entry string) bool {
+		return p.shouldIgnore(entry, defaultIgnoreList)
+	})
+}
+
+// Info describes the package and how it was loaded
+func (p PackageManager) Info() PackageInfo {
+	loadedAt := p.loadedAt
+	return PackageInfo{
+		Name:                 p.name,
+		Path:                 p.dirPath,
+		SnapshotOf:           p.origin,
+		Status:               PackageReady,
+		LoadedAt:             &loadedAt,
+		LoadMillis:           p.loadDuration.Milliseconds(),
+		PackageCount:         len(p.ca.PackagePaths()),
+		LoadErrors:           p.ca.LoadErrors(),
+		EstimatedMemoryBytes: p.memoryBytes,
+		ProjectInfo:          &p.ProjectInfo,
+	}
+}
+
+// packageDirs lists every directory under dirPath that may contain Go packages
+func packageDirs(dirPath string) []string {
 	allPaths := []string{}
 	filepath.WalkDir(dirPath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
@@ -86,29 +190,72 @@ func NewPackageManager(name, dirPath string) (PackageManager, error) {
 		}
 		return nil
 	})
+	return allPaths
+}
+
+// loadCallGraph loads every package under dirPath into a new CallGraphAnalyzer
+func loadCallGraph(dirPath string) (*utils.CallGraphAnalyzer, error) {
+	return loadCallGraphContext(context.Background(), dirPath, nil)
+}
+
+// loadCallGraphContext loads the packages like loadCallGraph, reporting progress and
+// stopping when ctx is canceled
+func loadCallGraphContext(ctx context.Context, dirPath string, progress func(loaded, total int)) (*utils.CallGraphAnalyzer, error) {
+	ca := utils.NewCallGraphAnalyzer(dirPath)
 
 	fmt.Println("Loading packages...")
 
-	err = ca.LoadPackages(dirPath, allPaths...)
+	if err := ca.LoadPackagesContext(ctx, dirPath, progress, packageDirs(dirPath)...); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// loadAtRef loads the package as it was at the given git ref from a temporary worktree.
+// The returned cleanup function removes the worktree again.
+func (p PackageManager) loadAtRef(ref string) (*utils.CallGraphAnalyzer, func(), error) {
+	// Locate the package inside the repository so the same subdirectory is loaded from the worktree
+	repoRoot, relDir, err := p.packageSubdir()
 	if err != nil {
-		return PackageManager{}, err
+		return nil, nil, err
 	}
 
-	return PackageManager{
-		name:        name,
-		dirPath:     dirPath,
-		ProjectInfo: projectInfo,
-		ca:          ca,
-	}, nil
+	commit, err := utils.ResolveRef(repoRoot, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	worktreeDir, err := os.MkdirTemp("", "codeviz-"+p.name+"-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		utils.RemoveWorktree(repoRoot, worktreeDir)
+		os.RemoveAll(worktreeDir)
+	}
+
+	if err := utils.AddWorktree(repoRoot, commit, worktreeDir); err != nil {
+		os.RemoveAll(worktreeDir)
+		return nil, nil, err
+	}
+
+	ca, err := loadCallGraph(filepath.Join(worktreeDir, relDir))
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return ca, cleanup, nil
 }
 
 // GetTreeStructure
 func (p PackageManager) GetTreeStructure(depth int) DirectoryInfo {
-	return p.getDirectoryStructure(p.dirPath, p.dirPath, depth, 0)
+	clones, _ := p.GetClones(utils.DefaultCloneMinLines)
+	return p.getDirectoryStructure(p.dirPath, p.dirPath, depth, 0, clones)
 }
 
 func (p PackageManager) GetCodeFlow(path, functionName string) (*utils.FunctionNode, error) {
-	dir, err := filepath.Abs(path)
+	dir, err := filepath.Abs(p.resolvePath(path))
 	if err != nil {
 		fmt.Printf("Error building function call tree: %v\n", err)
 		return nil, fmt.Errorf("Error building function call tree: %v\n", err)
@@ -123,11 +270,11 @@ func (p PackageManager) GetCodeFlow(path, functionName string) (*utils.FunctionN
 		return nil, fmt.Errorf("Error building function call tree: %v\n", err)
 	}
 
-	return functionTree, nil
+	return p.annotateOwnership(functionTree), nil
 }
 
 // getDirectoryStructure recursively builds the directory structure
-func (p PackageManager) getDirectoryStructure(basePath, currentPath string, maxDepth, currentDepth int) DirectoryInfo {
+func (p PackageManager) getDirectoryStructure(basePath, currentPath string, maxDepth, currentDepth int, clones utils.CloneReport) DirectoryInfo {
 	info, err := os.Stat(currentPath)
 	if err != nil {
 		// Return empty structure if error
@@ -144,6 +291,9 @@ func (p PackageManager) getDirectoryStructure(basePath, currentPath string, maxD
 		Path:  strings.TrimPrefix(currentPath, basePath),
 		IsDir: info.IsDir(),
 	}
+	if !dirInfo.IsDir {
+		dirInfo.DuplicatePct = clones.DuplicatePercentage(dirInfo.Path)
+	}
 
 	// If it's not a directory or we've reached max depth, don't process children
 	if !info.IsDir() || (maxDepth >= 0 && currentDepth >= maxDepth) {
@@ -165,7 +315,7 @@ func (p PackageManager) getDirectoryStructure(basePath, currentPath string, maxD
 		}
 
 		childPath := filepath.Join(currentPath, file.Name())
-		childInfo := p.getDirectoryStructure(basePath, childPath, maxDepth, currentDepth+1)
+		childInfo := p.getDirectoryStructure(basePath, childPath, maxDepth, currentDepth+1, clones)
 		dirInfo.Children = append(dirInfo.Children, childInfo)
 	}
 
@@ -190,7 +340,11 @@ func (p PackageManager) shouldIgnore(name string, ignorePatterns []string) bool
 
 // GetGitStats
 func (p PackageManager) GetGitStats() utils.GitStats {
-	return utils.GetGitStats(p.dirPath)
+	stats := utils.GetGitStats(p.dirPath, p.identityRules())
+	if lines, err := p.GetLineCounts(); err == nil {
+		stats.FileStats.TotalLines = lines.Total.Total
+	}
+	return stats
 }
 
 // GetLintIssues
@@ -200,21 +354,22 @@ func (p PackageManager) GetLintIssues() (utils.LintIssues, error) {
 
 // FindFunctions
 func (p PackageManager) FindFunctions(path string) ([]string, error) {
-	return utils.FindFunctions(path)
+	return utils.FindFunctions(p.resolvePath(path))
 }
 
 // CloneRepo
 func (p PackageManager) CloneRepo(url, branch string) error {
-	return utils.CloneRepo(url, p.dirPath)
+	return utils.CloneRepo(url, p.dirPath, utils.CloneOptions{Branch: branch})
 }
 
 // GetFileContributions
 func (p PackageManager) GetFileContributions(filePath string) ([]utils.FileContributor, error) {
-	return utils.GetFileContributions(p.dirPath, filePath)
+	return utils.GetFileContributions(p.dirPath, p.resolvePath(filePath), p.identityRules())
 }
 
 // GetFileContent
 func (p PackageManager) GetFileContent(filePath string) (string, error) {
+	filePath = p.resolvePath(filePath)
 	stats, err := os.Stat(filePath)
 	if err != nil {
 		return "", err
@@ -243,3 +398,716 @@ func (p PackageManager) GetCodeCoverage(specificPath string) (utils.CoverageStat
 
 	return utils.GetCodeCoverage(p.dirPath, cleanPath)
 }
+
+// GetCallGraphDiff loads the package at two git refs and compares their call graphs
+func (p PackageManager) GetCallGraphDiff(baseRef, headRef string) (utils.CallGraphDiff, error) {
+	base, cleanupBase, err := p.loadAtRef(baseRef)
+	if err != nil {
+		return utils.CallGraphDiff{}, err
+	}
+	defer cleanupBase()
+
+	head, cleanupHead, err := p.loadAtRef(headRef)
+	if err != nil {
+		return utils.CallGraphDiff{}, err
+	}
+	defer cleanupHead()
+
+	diff := utils.DiffCallGraphs(base, head)
+	diff.BaseRef = baseRef
+	diff.HeadRef = headRef
+
+	return diff, nil
+}
+
+// CheckArchitecture evaluates the architecture rules file against the import and call graphs.
+// The rules are read from the project root when no rules path is given.
+func (p PackageManager) CheckArchitecture(rulesPath string) (utils.ArchReport, error) {
+	if rulesPath == "" {
+		rulesPath = filepath.Join(p.dirPath, utils.ArchRulesFile)
+	}
+
+	rules, err := utils.LoadArchRules(rulesPath)
+	if err != nil {
+		return utils.ArchReport{}, err
+	}
+
+	return utils.ArchReport{
+		RulesFile:  rulesPath,
+		Rules:      rules,
+		Violations: utils.CheckArchitecture(p.ca, rules, p.ProjectInfo.ModuleName),
+	}, nil
+}
+
+// GetAPISurface lists the exported API of the package
+func (p PackageManager) GetAPISurface() []utils.APIElement {
+	return p.ca.APISurface()
+}
+
+// GetAPIDiff compares the exported API at the base ref with the API at the head ref and
+// suggests the next version based on the latest version tag. Without a head ref the base
+// is compared with the package as it was loaded: the working tree, or the commit of a
+// snapshot.
+func (p PackageManager) GetAPIDiff(baseRef, headRef string) (utils.APIDiff, error) {
+	base, cleanupBase, err := p.loadAtRef(baseRef)
+	if err != nil {
+		return utils.APIDiff{}, err
+	}
+	defer cleanupBase()
+
+	head := p.ca
+	headLabel := headRef
+	switch {
+	case headRef != "":
+		var cleanupHead func()
+		head, cleanupHead, err = p.loadAtRef(headRef)
+		if err != nil {
+			return utils.APIDiff{}, err
+		}
+		defer cleanupHead()
+	case p.origin != "":
+		if headLabel, err = utils.ResolveRef(p.dirPath, "HEAD"); err != nil {
+			return utils.APIDiff{}, err
+		}
+	default:
+		headLabel = "working tree"
+	}
+
+	diff := utils.DiffAPISurfaces(base.APISurface(), head.APISurface())
+	diff.BaseRef = baseRef
+	diff.HeadRef = headLabel
+	diff.SuggestVersion(utils.LatestVersionTag(p.dirPath))
+
+	return diff, nil
+}
+
+// GetFieldUsage lists the read, write and initialization sites of every field of a struct type
+func (p PackageManager) GetFieldUsage(typeName string) (utils.StructFieldUsage, error) {
+	return p.ca.FieldUsage(typeName)
+}
+
+// GetDesignMetrics computes package coupling metrics and function fan-in/fan-out
+func (p PackageManager) GetDesignMetrics() utils.DesignMetrics {
+	return p.ca.DesignMetrics()
+}
+
+// GetClones detects duplicated statement sequences spanning at least minLines lines.
+// minLines is clamped to utils.MaxCloneMinLines, which bounds the cached reports.
+func (p PackageManager) GetClones(minLines int) (utils.CloneReport, error) {
+	if minLines <= 0 {
+		minLines = utils.DefaultCloneMinLines
+	}
+	minLines = min(minLines, utils.MaxCloneMinLines)
+	return cached(p.cache, fmt.Sprintf("clones:%d", minLines), func() (utils.CloneReport, error) {
+		return p.ca.DetectClones(minLines), nil
+	})
+}
+
+// GetHotspots ranks files and functions by their change frequency since the given
+// date combined with their complexity. The date is rounded down to its day.
+func (p PackageManager) GetHotspots(since string) (utils.HotspotReport, error) {
+	since, err := utils.ResolveSince(p.dirPath, since)
+	if err != nil {
+		return utils.HotspotReport{}, err
+	}
+	return cached(p.cache, "hotspots:"+since, func() (utils.HotspotReport, error) {
+		fileChurn, err := utils.GetFileChurn(p.dirPath, since)
+		if err != nil {
+			return utils.HotspotReport{}, fmt.Errorf("failed to read git history: %w", err)
+		}
+
+		functionChurn, err := utils.GetFunctionChurn(p.dirPath, since)
+		if err != nil {
+			return utils.HotspotReport{}, fmt.Errorf("failed to read git history: %w", err)
+		}
+
+		report := utils.BuildHotspots(p.ca, fileChurn, functionChurn)
+		report.Since = since
+		return report, nil
+	})
+}
+
+// relativePath converts a file path, absolute or relative to the working directory,
+// into a path relative to the package directory
+func (p PackageManager) relativePath(filePath string) (string, error) {
+	absPath, err := filepath.Abs(p.resolvePath(filePath))
+	if err != nil {
+		return "", err
+	}
+	relPath, err := filepath.Rel(p.dirPath, absPath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("%s is outside of the package", filePath)
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
+// blame returns the git blame of a file relative to the package directory
+func (p PackageManager) blame(relPath string, options utils.BlameOptions) ([]utils.BlameLine, error) {
+	key := fmt.Sprintf("blame:%s:%t:%s", relPath, options.FollowCopies, options.IgnoreRevsFile)
+	return cached(p.cache, key, func() ([]utils.BlameLine, error) {
+		blame, err := utils.BlameFile(p.dirPath, relPath, options)
+		if err != nil {
+			return nil, err
+		}
+
+		// Blame applies .mailmap, the identity rules complete the unification
+		rules := p.identityRules()
+		for i := range blame {
+			blame[i].Author, blame[i].Email = rules.Canonical(blame[i].Author, blame[i].Email)
+		}
+		return blame, nil
+	})
+}
+
+// GetFunctionOwnership computes the primary author, contributor shares, last commit and
+// age of every function, optionally restricted to a single file. Functions of files
+// without blame, such as untracked files, have no ownership.
+func (p PackageManager) GetFunctionOwnership(filePath string) ([]utils.FunctionOwner, error) {
+	relPath := ""
+	if filePath != "" {
+		var err error
+		if relPath, err = p.relativePath(filePath); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	owners := []utils.FunctionOwner{}
+	unblamed := make(map[string]bool) // Failed blame is not cached, so it is not retried per function
+	for _, span := range p.ca.FunctionSpans() {
+		if relPath != "" && span.File != relPath {
+			continue
+		}
+
+		// Files git cannot blame, such as untracked ones, leave their functions without owner
+		owner := utils.FunctionOwner{FunctionSpan: span}
+		if !unblamed[span.File] {
+			if blame, err := p.blame(span.File, utils.BlameOptions{}); err == nil {
+				owner.Ownership = utils.ComputeOwnership(blame, span.StartLine, span.EndLine, now)
+			} else {
+				unblamed[span.File] = true
+			}
+		}
+		owners = append(owners, owner)
+	}
+
+	return owners, nil
+}
+
+// annotateOwnership returns a copy of a call tree with the ownership of every analysed
+// function set. The nodes of the analyzer are shared between requests, so they are left
+// untouched. Functions of files without blame, such as untracked files, have no ownership.
+func (p PackageManager) annotateOwnership(root *utils.FunctionNode) *utils.FunctionNode {
+	spans := make(map[string]utils.FunctionSpan)
+	for _, span := range p.ca.FunctionSpans() {
+		spans[span.Function] = span
+	}
+
+	now := time.Now()
+	unblamed := make(map[string]bool)
+	copies := make(map[*utils.FunctionNode]*utils.FunctionNode)
+	var walk func(node *utils.FunctionNode) *utils.FunctionNode
+	walk = func(node *utils.FunctionNode) *utils.FunctionNode {
+		if node == nil {
+			return nil
+		}
+		if annotated, ok := copies[node]; ok {
+			return annotated
+		}
+		annotated := *node
+		annotated.Ownership = nil
+		copies[node] = &annotated
+
+		// Calls into other modules carry the call site's file, which never matches a declaration
+		if span, ok := spans[node.Package+"."+node.Name]; ok {
+			if relPath, err := p.relativePath(node.File); err == nil && relPath == span.File && !unblamed[relPath] {
+				if blame, err := p.blame(relPath, utils.BlameOptions{}); err == nil {
+					annotated.Ownership = utils.ComputeOwnership(blame, span.StartLine, span.EndLine, now)
+				} else {
+					unblamed[relPath] = true
+				}
+			}
+		}
+
+		if node.Children != nil {
+			annotated.Children = make([]*utils.FunctionNode, len(node.Children))
+		}
+		for i, child := range node.Children {
+			annotated.Children[i] = walk(child)
+		}
+		return &annotated
+	}
+
+	return walk(root)
+}
+
+// GetFunctionHistory returns the commits that changed a function declared in a file
+func (p PackageManager) GetFunctionHistory(filePath, functionName string) (utils.FunctionHistory, error) {
+	relPath, err := p.relativePath(filePath)
+	if err != nil {
+		return utils.FunctionHistory{}, err
+	}
+
+	for _, span := range p.ca.FunctionSpans() {
+		if span.File != relPath || span.Name != functionName {
+			continue
+		}
+
+		revisions, err := utils.GetFunctionHistory(p.dirPath, span.File, functionName)
+		if err != nil {
+			return utils.FunctionHistory{}, err
+		}
+		return utils.FunctionHistory{
+			Function:  span.Function,
+			File:      span.File,
+			StartLine: span.StartLine,
+			EndLine:   span.EndLine,
+			Revisions: revisions,
+		}, nil
+	}
+
+	return utils.FunctionHistory{}, fmt.Errorf("function %s not found in %s", functionName, relPath)
+}
+
+// GetBlame returns the commit, author, date, age and original line number of every line
+// of a file, following moved and copied lines. Commits listed in ignoreRevsFile, a path
+// relative to the repository root, are skipped; by default the repository's
+// .git-blame-ignore-revs is used when present.
+func (p PackageManager) GetBlame(filePath, ignoreRevsFile string) (utils.FileBlame, error) {
+	relPath, err := p.relativePath(filePath)
+	if err != nil {
+		return utils.FileBlame{}, err
+	}
+
+	repoRoot, err := utils.RepoRoot(p.dirPath)
+	if err != nil {
+		return utils.FileBlame{}, err
+	}
+
+	options := utils.BlameOptions{FollowCopies: true}
+	if ignoreRevsFile == "" {
+		if _, err := os.Stat(filepath.Join(repoRoot, utils.DefaultIgnoreRevsFile)); err == nil {
+			ignoreRevsFile = utils.DefaultIgnoreRevsFile
+		}
+	}
+	if ignoreRevsFile != "" {
+		// The file must stay inside the repository, symbolic links included
+		resolved, err := filepath.EvalSymlinks(filepath.Join(repoRoot, ignoreRevsFile))
+		realRoot, rootErr := filepath.EvalSymlinks(repoRoot)
+		if err != nil || rootErr != nil || !isWithin(realRoot, resolved) {
+			return utils.FileBlame{}, fmt.Errorf("ignore revs file %s not found", ignoreRevsFile)
+		}
+		options.IgnoreRevsFile = resolved
+	}
+
+	blame, err := p.blame(relPath, options)
+	if err != nil {
+		return utils.FileBlame{}, err
+	}
+
+	// Ages are computed per request since cached blame outlives the day it was taken
+	now := time.Now()
+	lines := make([]utils.BlameLine, len(blame))
+	for i, line := range blame {
+		line.AgeDays = int(now.Sub(line.AuthorTime).Hours() / 24)
+		lines[i] = line
+	}
+
+	return utils.FileBlame{
+		File:           relPath,
+		IgnoreRevsFile: ignoreRevsFile,
+		Lines:          lines,
+	}, nil
+}
+
+// GetCommitLog returns a page of the package's commit history matching the filter.
+// An empty cursor starts at the current HEAD.
+func (p PackageManager) GetCommitLog(cursor string, limit int, filter utils.CommitFilter) (utils.CommitPage, error) {
+	head, offset := "", 0
+	if cursor != "" {
+		var err error
+		if head, offset, err = utils.DecodeCommitCursor(cursor); err != nil {
+			return utils.CommitPage{}, err
+		}
+	} else {
+		var err error
+		if head, err = utils.ResolveRef(p.dirPath, "HEAD"); err != nil {
+			return utils.CommitPage{}, err
+		}
+	}
+
+	if filter.Path != "" {
+		relPath, err := p.relativePath(filter.Path)
+		if err != nil {
+			return utils.CommitPage{}, err
+		}
+		filter.Path = relPath
+	}
+
+	return utils.GetCommitLog(p.dirPath, head, offset, limit, filter)
+}
+
+// GetCommitDetail returns a commit's metadata, its diff parsed into files, hunks and
+// lines, and the functions each hunk modifies
+func (p PackageManager) GetCommitDetail(ref string) (utils.CommitDetail, error) {
+	commit, err := utils.ResolveRef(p.dirPath, ref)
+	if err != nil {
+		return utils.CommitDetail{}, err
+	}
+
+	// Commits never change, so their details stay valid until the package is reloaded
+	return cached(p.cache, "commit:"+commit, func() (utils.CommitDetail, error) {
+		detail, err := utils.GetCommitDetail(p.dirPath, commit)
+		if err != nil {
+			return utils.CommitDetail{}, err
+		}
+		p.ca.AnnotateFunctions(p.dirPath, &detail)
+		return detail, nil
+	})
+}
+
+// GetRefs lists the branches and tags the package can be analyzed at
+func (p PackageManager) GetRefs() ([]utils.GitRef, error) {
+	return utils.ListRefs(p.dirPath)
+}
+
+// identityRulesEnv points to identity rules applied to every package, on top of the
+// rules file of each package
+const identityRulesEnv = "CODEVIZ_IDENTITIES"
+
+// loadIdentityRules reads the server's and the package's identity rules and merges
+// them. The paths of the files that exist are returned along with the rules.
+func (p PackageManager) loadIdentityRules() (utils.IdentityRules, string, string, error) {
+	serverPath := os.Getenv(identityRulesEnv)
+	serverRules := utils.IdentityRules{}
+	if serverPath != "" {
+		rules, err := utils.LoadIdentityRules(serverPath)
+		if err != nil {
+			return utils.IdentityRules{}, "", "", fmt.Errorf("%s: %w", serverPath, err)
+		}
+		serverRules = rules
+		if _, err := os.Stat(serverPath); err != nil {
+			serverPath = ""
+		}
+	}
+
+	rulesPath := filepath.Join(p.dirPath, utils.IdentityRulesFile)
+	rules, err := utils.LoadIdentityRules(rulesPath)
+	if err != nil {
+		return utils.IdentityRules{}, "", "", err
+	}
+	if _, err := os.Stat(rulesPath); err != nil {
+		rulesPath = ""
+	}
+
+	return rules.Merge(serverRules), serverPath, rulesPath, nil
+}
+
+// identityRules loads the contributor identity rules of the package. Invalid rules are
+// reported and ignored so contributor stats stay available.
+func (p PackageManager) identityRules() utils.IdentityRules {
+	rules, _, _, err := p.loadIdentityRules()
+	if err != nil {
+		fmt.Printf("Error loading identity rules: %v\n", err)
+		return utils.IdentityRules{}
+	}
+	return rules
+}
+
+// GetIdentities lists the package's contributors after applying .mailmap and the
+// identity rules, with the names and emails merged into each of them
+func (p PackageManager) GetIdentities() (utils.IdentityReport, error) {
+	rules, serverPath, rulesPath, err := p.loadIdentityRules()
+	if err != nil {
+		return utils.IdentityReport{}, err
+	}
+
+	identities, err := utils.ResolveIdentities(p.dirPath, rules)
+	if err != nil {
+		return utils.IdentityReport{}, err
+	}
+
+	return utils.IdentityReport{
+		ServerRulesFile: serverPath,
+		RulesFile:       rulesPath,
+		Rules:           rules,
+		Identities:      identities,
+	}, nil
+}
+
+// GetActivity returns the package's commit activity per day, week or month and its
+// weekday by hour commit heatmap
+func (p PackageManager) GetActivity(granularity string, filter utils.ActivityFilter) (utils.ActivityReport, error) {
+	if filter.Path != "" {
+		relPath, err := p.relativePath(filter.Path)
+		if err != nil {
+			return utils.ActivityReport{}, err
+		}
+		filter.Path = relPath
+	}
+
+	return utils.GetActivity(p.dirPath, granularity, filter, p.identityRules())
+}
+
+// GetChangeCoupling finds the files changed together since the given date and the
+// functions whose surviving lines come from the same commits made since then, flagging
+// the pairs without any static dependency. The date is rounded down to its day, the
+// minimum support is clamped to utils.MaxCouplingMinSupport and the minimum strength is
+// rounded to hundredths, which bounds the cached reports.
+func (p PackageManager) GetChangeCoupling(since string, minSupport int, minStrength float64) (utils.CouplingReport, error) {
+	since, err := utils.ResolveSince(p.dirPath, since)
+	if err != nil {
+		return utils.CouplingReport{}, err
+	}
+	minSupport = min(minSupport, utils.MaxCouplingMinSupport)
+	minStrength = math.Round(minStrength*100) / 100
+
+	key := fmt.Sprintf("coupling:%s:%d:%.2f", since, minSupport, minStrength)
+	return cached(p.cache, key, func() (utils.CouplingReport, error) {
+		changeSets, err := utils.GetFileChangeSets(p.dirPath, since)
+		if err != nil {
+			return utils.CouplingReport{}, err
+		}
+		files := utils.CouplingPairs("file", changeSets, minSupport, minStrength)
+		p.ca.ClassifyFileCoupling(files)
+
+		// Files git cannot blame, such as untracked ones, have no history to couple
+		blameRanges := make(map[string][]utils.BlameLine)
+		unblamed := make(map[string]bool)
+		for _, span := range p.ca.FunctionSpans() {
+			if unblamed[span.File] {
+				continue
+			}
+			blame, err := p.blame(span.File, utils.BlameOptions{})
+			if err != nil {
+				unblamed[span.File] = true
+				continue
+			}
+			for _, line := range blame {
+				if line.Line >= span.StartLine && line.Line <= span.EndLine {
+					blameRanges[span.Function] = append(blameRanges[span.Function], line)
+				}
+			}
+		}
+		var commits map[string]bool
+		if since != "" {
+			if commits, err = utils.GetCommitsSince(p.dirPath, since); err != nil {
+				return utils.CouplingReport{}, err
+			}
+		}
+		functions := utils.CouplingPairs("function", utils.FunctionChangeSets(blameRanges, commits), minSupport, minStrength)
+		p.ca.ClassifyFunctionCoupling(functions)
+
+		return utils.CouplingReport{
+			Since:       since,
+			MinSupport:  minSupport,
+			MinStrength: minStrength,
+			Files:       files,
+			Functions:   functions,
+		}, nil
+	})
+}
+
+// GetBusFactor computes the bus factor and knowledge distribution of every directory
+// and file from the blame of the tracked files. Areas whose main author has not
+// committed for staleDays are flagged. Depths beyond utils.MaxBusFactorDepth mean no
+// limit and staleDays is clamped to utils.MaxStaleDays, which bounds the cached reports.
+func (p PackageManager) GetBusFactor(depth, staleDays int) (BusFactorInfo, error) {
+	if depth > utils.MaxBusFactorDepth {
+		depth = -1
+	}
+	staleDays = min(staleDays, utils.MaxStaleDays)
+	return cached(p.cache, fmt.Sprintf("busfactor:%d:%d", depth, staleDays), func() (BusFactorInfo, error) {
+		tracked, err := utils.TrackedFiles(p.dirPath)
+		if err != nil {
+			return BusFactorInfo{}, err
+		}
+
+		rules := p.identityRules()
+		lastCommits, err := utils.LastCommitDates(p.dirPath, rules)
+		if err != nil {
+			return BusFactorInfo{}, err
+		}
+
+		ctx := busFactorContext{
+			tracked:     tracked,
+			lastCommits: lastCommits,
+			staleBefore: time.Now().AddDate(0, 0, -staleDays),
+			rules:       rules,
+		}
+		info, _ := p.getBusFactorStructure(p.dirPath, p.dirPath, depth, 0, ctx)
+		return info, nil
+	})
+}
+
+// getBusFactorStructure recursively builds the bus factor tree. Knowledge is always
+// collected from the whole subtree, while children are only listed up to maxDepth.
+func (p PackageManager) getBusFactorStructure(basePath, currentPath string, maxDepth, currentDepth int, ctx busFactorContext) (BusFactorInfo, utils.KnowledgeMap) {
+	knowledge := utils.KnowledgeMap{}
+	info := BusFactorInfo{
+		Name: filepath.Base(currentPath),
+		Path: strings.TrimPrefix(currentPath, basePath),
+	}
+
+	stat, err := os.Stat(currentPath)
+	if err != nil {
+		return info, knowledge
+	}
+	info.IsDir = stat.IsDir()
+
+	if !info.IsDir {
+		relPath, err := filepath.Rel(basePath, currentPath)
+		if err == nil && ctx.tracked[filepath.ToSlash(relPath)] {
+			blame, err := p.blame(filepath.ToSlash(relPath), utils.BlameOptions{})
+			if err != nil {
+				fmt.Printf("Error computing blame of %s: %v\n", relPath, err)
+			}
+			knowledge.AddBlame(blame, ctx.rules)
+		}
+	} else if files, err := os.ReadDir(currentPath); err == nil {
+		for _, file := range files {
+			if p.shouldIgnore(file.Name(), defaultIgnoreList) {
+				continue
+			}
+
+			childPath := filepath.Join(currentPath, file.Name())
+			childInfo, childKnowledge := p.getBusFactorStructure(basePath, childPath, maxDepth, currentDepth+1, ctx)
+			knowledge.Merge(childKnowledge)
+			if maxDepth < 0 || currentDepth < maxDepth {
+				info.Children = append(info.Children, childInfo)
+			}
+		}
+	}
+
+	info.Authors = knowledge.Shares()
+	for i := range info.Authors {
+		info.Lines += info.Authors[i].Lines
+		if lastCommit, ok := ctx.lastCommits[strings.ToLower(info.Authors[i].Email)]; ok {
+			info.Authors[i].LastCommit = lastCommit.Format("2006-01-02")
+		}
+	}
+	info.BusFactor = utils.BusFactor(info.Authors)
+	if len(info.Authors) > 0 {
+		info.MainAuthor = info.Authors[0].Name
+		info.Stale = ctx.lastCommits[strings.ToLower(info.Authors[0].Email)].Before(ctx.staleBefore)
+	}
+
+	return info, knowledge
+}
+
+// GetLineCounts counts the code, comment and blank lines of the package per language,
+// directory and file, skipping the same entries as the tree view
+func (p PackageManager) GetLineCounts() (utils.LineCountReport, error) {
+	return cached(p.cache, "linecount", func() (utils.LineCountReport, error) {
+		return utils.CountLines(p.dirPath, func(name string) bool {
+			return p.shouldIgnore(name, defaultIgnoreList)
+		})
+	})
+}
+
+// Refresh updates the package's clone from its remote, to the latest state of the
+// current branch or to ref, and loads it again. options authenticates the fetch. Every
+// cached analysis of the package, its coverage and its lint results are dropped.
+// Snapshots are kept since they are tied to commits that do not change.
+func (p PackageManager) Refresh(ref string, options utils.CloneOptions) (utils.RepoUpdate, PackageManager, error) {
+	if p.origin != "" {
+		return utils.RepoUpdate{}, PackageManager{}, errors.New("cannot refresh a snapshot")
+	}
+
+	repoRoot, _, err := p.packageSubdir()
+	if err != nil {
+		return utils.RepoUpdate{}, PackageManager{}, err
+	}
+
+	update, err := utils.UpdateRepo(repoRoot, ref, options)
+	if err != nil {
+		return utils.RepoUpdate{}, PackageManager{}, err
+	}
+
+	refreshed, err := p.Reload()
+	if err != nil {
+		return update, PackageManager{}, err
+	}
+
+	return update, refreshed, nil
+}
+
+// Reload loads the package again from its directory. Every cached analysis of the
+// package, its coverage and its lint results are dropped.
+func (p PackageManager) Reload() (PackageManager, error) {
+	if p.origin != "" {
+		return PackageManager{}, errors.New("cannot reload a snapshot")
+	}
+
+	if err := p.dropCaches(); err != nil {
+		return PackageManager{}, err
+	}
+
+	reloaded, err := NewPackageManager(p.name, p.dirPath)
+	if err != nil {
+		return PackageManager{}, fmt.Errorf("failed to reload %s: %w", p.name, err)
+	}
+	return reloaded, nil
+}
+
+// ReloadChanged brings the package up to date with changed files. Only the Go packages
+// in their directories and the packages depending on them are type-checked again, unless
+// a module file or the set of imported packages changed, which reloads everything.
+// Cached analyses, coverage and lint results are dropped like on a full reload. stamps
+// is the scan the changes were found in, kept as the files the reload started from. The
+// reloaded import paths are returned.
+func (p PackageManager) ReloadChanged(changes []utils.FileChange, stamps map[string]utils.FileStamp) (PackageManager, []string, error) {
+	if p.origin != "" {
+		return PackageManager{}, nil, errors.New("cannot reload a snapshot")
+	}
+
+	dirs := []string{}
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		if utils.IsModuleFile(change.Path) {
+			reloaded, err := p.Reload()
+			if err != nil {
+				return PackageManager{}, nil, err
+			}
+			return reloaded, reloaded.ca.PackagePaths(), nil
+		}
+		if dir := filepath.Dir(change.Path); !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if err := p.dropCaches(); err != nil {
+		return PackageManager{}, nil, err
+	}
+
+	start := time.Now()
+	ca, pkgPaths, err := p.ca.ReloadPackages(context.Background(), dirs)
+	if errors.Is(err, utils.ErrImportsChanged) {
+		reloaded, err := p.Reload()
+		if err != nil {
+			return PackageManager{}, nil, err
+		}
+		return reloaded, reloaded.ca.PackagePaths(), nil
+	}
+	if err != nil {
+		return PackageManager{}, nil, fmt.Errorf("failed to reload %s: %w", p.name, err)
+	}
+
+	p.ca = ca
+	p.cache = newAnalysisCache()
+	p.stamps = stamps
+	p.loadedAt = time.Now()
+	p.loadDuration = time.Since(start)
+	p.memoryBytes = ca.EstimatedMemory()
+	return p, pkgPaths, nil
+}
+
+// dropCaches drops every cached analysis of the package, its coverage and its lint results
+func (p PackageManager) dropCaches() error {
+	p.cache.invalidate()
+	if err := utils.ClearCoverageCacheFor(p.dirPath); err != nil {
+		return err
+	}
+	return utils.ClearLintResults(p.dirPath)
+}
@@ -0,0 +1,139 @@
+package logic
+
+import "errors"
+
+// Load states of a registered package
+const (
+	PackageUnloaded  = "unloaded" // Restored from the registry but not requested yet
+	PackageLoading   = "loading"
+	PackageReady     = "ready"
+	PackageFailed    = "failed"
+	PackageReloading = "reloading" // Served from its previous load until the reload finishes
+)
+
+// errPackageBusy is returned when a package is already being loaded or reloaded
+var errPackageBusy = errors.New("package is already loading")
+
+// packageEntry is a package and its load state. Its fields are guarded by the mutex
+// of the PackageHandler holding it.
+type packageEntry struct {
+	state string
+	path  string
+	pm    PackageManager // Valid while ready or reloading
+	err   error          // Why the last load failed
+	done  chan struct{}  // Closed when the running load or reload finishes
+}
+
+// lookup returns the entry of a package
+func (p *PackageHandler) lookup(name string) (*packageEntry, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	entry, ok := p.packages[name]
+	return entry, ok
+}
+
+// wait returns the package of an entry, waiting for its first load to finish.
+// Reloading packages are served from their previous load right away.
+func (p *PackageHandler) wait(entry *packageEntry) (PackageManager, error) {
+	for {
+		p.mu.RLock()
+		state, pm, err, done := entry.state, entry.pm, entry.err, entry.done
+		p.mu.RUnlock()
+
+		switch state {
+		case PackageReady, PackageReloading:
+			return pm, nil
+		case PackageFailed:
+			return PackageManager{}, err
+		}
+		<-done
+	}
+}
+
+// settle waits until no load or reload of an entry is running
+func (p *PackageHandler) settle(entry *packageEntry) {
+	for {
+		p.mu.RLock()
+		state, done := entry.state, entry.done
+		p.mu.RUnlock()
+
+		if state != PackageLoading && state != PackageReloading {
+			return
+		}
+		<-done
+	}
+}
+
+// loadOnce loads a package unless it is loaded or loading already, in which case that
+// load is waited for, so concurrent requests share a single load. Failed loads of
+// packages missing from the registry are forgotten so they can be retried.
+func (p *PackageHandler) loadOnce(name, path string, load func() (PackageManager, error)) (PackageManager, error) {
+	p.mu.Lock()
+	if entry, ok := p.packages[name]; ok {
+		p.mu.Unlock()
+		return p.wait(entry)
+	}
+	entry := &packageEntry{state: PackageLoading, path: path, done: make(chan struct{})}
+	p.packages[name] = entry
+	p.mu.Unlock()
+
+	pm, err := load()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer close(entry.done)
+
+	if err != nil {
+		entry.state, entry.err = PackageFailed, err
+		if _, registered := p.registry.lookup(name); !registered && p.packages[name] == entry {
+			delete(p.packages, name)
+		}
+		return PackageManager{}, err
+	}
+	entry.state, entry.pm, entry.path, entry.err = PackageReady, pm, pm.dirPath, nil
+	return pm, nil
+}
+
+// reloadOnce replaces a package with the result of reload, which gets the previous load
+// and the package's directory. Requests keep being served from the previous load in the
+// meantime, and it stays in place if the reload fails. Packages that failed to load are
+// loading again instead. errPackageBusy is returned while another load runs.
+func (p *PackageHandler) reloadOnce(name string, reload func(previous PackageManager, path string) (PackageManager, error)) (PackageManager, error) {
+	p.mu.Lock()
+	entry, ok := p.packages[name]
+	if !ok {
+		p.mu.Unlock()
+		return PackageManager{}, errors.New("unknown package")
+	}
+	if entry.state == PackageLoading || entry.state == PackageReloading {
+		p.mu.Unlock()
+		return PackageManager{}, errPackageBusy
+	}
+
+	previous, previousState, path := entry.pm, entry.state, entry.path
+	if previousState == PackageReady {
+		entry.state = PackageReloading
+	} else {
+		entry.state = PackageLoading
+	}
+	entry.done = make(chan struct{})
+	p.mu.Unlock()
+
+	pm, err := reload(previous, path)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer close(entry.done)
+
+	switch {
+	case err == nil:
+		entry.state, entry.pm, entry.err = PackageReady, pm, nil
+		return pm, nil
+	case previousState == PackageReady:
+		entry.state = PackageReady
+	default:
+		entry.state, entry.err = PackageFailed, err
+	}
+	return PackageManager{}, err
+}
@@ -0,0 +1,217 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"tbd.com/utils"
+)
+
+// Restore modes of the registered packages on startup
+const (
+	RestoreLazy  = "lazy"  // Load a package on its first request
+	RestoreEager = "eager" // Load every package before serving requests
+)
+
+// Environment variables configuring the package registry
+const (
+	registryPathEnv = "CODEVIZ_REGISTRY"
+	restoreModeEnv  = "CODEVIZ_RESTORE"
+)
+
+// defaultRegistryPath is the registry file, next to the repos directory of the clones
+const defaultRegistryPath = "codeviz-registry.json"
+
+// PackageRegistration is everything needed to load a registered package again
+type PackageRegistration struct {
+	Name         string              `json:"name"`
+	Path         string              `json:"path"`
+	OriginURL    string              `json:"originURL,omitempty"`
+	Ref          string              `json:"ref,omitempty"` // Branch or commit checked out when registered
+	Settings     *utils.CloneOptions `json:"settings,omitempty"`
+	RegisteredAt time.Time           `json:"registeredAt"`
+}
+
+// registryFile is the stored form of the registry
+type registryFile struct {
+	Version  int                   `json:"version"`
+	Packages []PackageRegistration `json:"packages"`
+}
+
+// packageRegistry persists the registered packages in a JSON file
+type packageRegistry struct {
+	mu      sync.Mutex
+	path    string // Persistence is disabled if empty
+	entries map[string]PackageRegistration
+	tokens  map[string]string // Clone tokens, kept in memory only
+}
+
+// loadRegistry reads the registry file at path. A missing file yields an empty registry.
+func loadRegistry(path string) (*packageRegistry, error) {
+	registry := &packageRegistry{
+		path:    path,
+		entries: make(map[string]PackageRegistration),
+		tokens:  make(map[string]string),
+	}
+	if path == "" {
+		return registry, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, fmt.Errorf("failed to read package registry: %w", err)
+	}
+
+	var file registryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return registry, fmt.Errorf("failed to parse package registry: %w", err)
+	}
+	for _, registration := range file.Packages {
+		registry.entries[registration.Name] = registration
+	}
+
+	return registry, nil
+}
+
+// lookup returns the registration of a package
+func (r *packageRegistry) lookup(name string) (PackageRegistration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registration, ok := r.entries[name]
+	return registration, ok
+}
+
+// list returns every registration sorted by name
+func (r *packageRegistry) list() []PackageRegistration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sorted()
+}
+
+// add stores or replaces a registration
+func (r *packageRegistry) add(registration PackageRegistration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[registration.Name] = registration
+	return r.save()
+}
+
+// remove drops a registration
+func (r *packageRegistry) remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, name)
+	delete(r.tokens, name)
+	return r.save()
+}
+
+// setToken remembers the token a package was cloned with until the server stops
+func (r *packageRegistry) setToken(name, token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token == "" {
+		delete(r.tokens, name)
+		return
+	}
+	r.tokens[name] = token
+}
+
+// cloneOptions returns the settings a package was cloned with, including its token if
+// it was cloned since the server started
+func (r *packageRegistry) cloneOptions(name string) utils.CloneOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	options := utils.CloneOptions{}
+	if settings := r.entries[name].Settings; settings != nil {
+		options = *settings
+	}
+	options.Token = r.tokens[name]
+	return options
+}
+
+// sorted returns the registrations sorted by name. The caller holds the lock.
+func (r *packageRegistry) sorted() []PackageRegistration {
+	registrations := make([]PackageRegistration, 0, len(r.entries))
+	for _, registration := range r.entries {
+		registrations = append(registrations, registration)
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		return registrations[i].Name < registrations[j].Name
+	})
+	return registrations
+}
+
+// save writes the registry file. It is replaced atomically, so a crash never leaves a
+// truncated registry behind. The caller holds the lock.
+func (r *packageRegistry) save() error {
+	if r.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(registryFile{Version: 1, Packages: r.sorted()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if dir := filepath.Dir(r.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmpPath := r.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write package registry: %w", err)
+	}
+	return os.Rename(tmpPath, r.path)
+}
+
+// newRegistration describes a package for the registry. The origin URL defaults to the
+// origin remote of the package's repository, and credentials are never stored: tokens are
+// dropped from the settings and passwords from the origin URL.
+func newRegistration(name, dirPath, originURL string, settings *utils.CloneOptions) PackageRegistration {
+	registration := PackageRegistration{
+		Name:         name,
+		Path:         dirPath,
+		OriginURL:    originURL,
+		RegisteredAt: time.Now().UTC(),
+	}
+	if registration.OriginURL == "" {
+		registration.OriginURL, _ = utils.OriginURL(dirPath)
+	}
+	registration.OriginURL = utils.RedactURL(registration.OriginURL)
+	registration.Ref, _ = utils.CurrentRef(dirPath)
+	if settings != nil {
+		stored := *settings
+		stored.Token = ""
+		registration.Settings = &stored
+	}
+	return registration
+}
+
+// registryConfig reads the registry file and restore mode from the environment
+func registryConfig() (string, string) {
+	path, ok := os.LookupEnv(registryPathEnv)
+	if !ok {
+		path = defaultRegistryPath
+	}
+
+	mode := os.Getenv(restoreModeEnv)
+	if mode != RestoreEager {
+		mode = RestoreLazy
+	}
+	return path, mode
+}
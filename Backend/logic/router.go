@@ -1,17 +1,17 @@
 package logic
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 
-	"path/filepath"
-
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"tbd.com/utils"
 )
 
 type Router struct {
-	packageHandler PackageHandler
+	packageHandler *PackageHandler
 }
 
 // NewRouter
@@ -37,6 +37,19 @@ func (r Router) helloHandler(c *gin.Context) {
 type CloneRepoRequest struct {
 	RepoURL    string `json:"repoURL"`
 	FolderName string `json:"foldername"`
+	utils.CloneOptions
+}
+
+// RefreshRequest
+type RefreshRequest struct {
+	Ref   string `json:"ref"`             // Branch, tag or commit to update to, the current branch if empty
+	Token string `json:"token,omitempty"` // Access token replacing the one the clone was made with
+}
+
+// PackageRequest
+type PackageRequest struct {
+	Name     string `json:"name"`
+	FilePath string `json:"filepath"`
 }
 
 // cloneRepo
@@ -50,7 +63,7 @@ func (r Router) cloneRepo(c *gin.Context) {
 		return
 	}
 
-	path, err := r.packageHandler.CloneRepo(req.RepoURL)
+	path, err := r.packageHandler.CloneRepo(req.RepoURL, req.CloneOptions)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -58,11 +71,9 @@ func (r Router) cloneRepo(c *gin.Context) {
 		return
 	}
 
-	filePath := filepath.Join(path, req.FolderName)
-	name := filepath.Base(filepath.Clean(path))
-	packageName := name + "-" + req.FolderName
+	filePath, packageName := clonedPackage(path, req.FolderName)
 
-	resp, err := r.packageHandler.addPackage(filePath, packageName)
+	resp, err := r.packageHandler.addClonedPackage(filePath, packageName, req.RepoURL, req.CloneOptions)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": err.Error(),
@@ -342,48 +353,1030 @@ func (r Router) getCodeCoverage(c *gin.Context) {
 	})
 }
 
-// Router setup
-func SetupRouter() *gin.Engine {
-	// Create a default gin router with default middleware
-	router := gin.Default()
+// getCallGraphDiff
+func (r Router) getCallGraphDiff(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
 
-	// Add CORS middleware
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-	}))
+	baseRef := c.Query("base")
+	if baseRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing base query parameter",
+		})
+		return
+	}
+	headRef := c.DefaultQuery("head", "HEAD")
 
-	r := NewRouter()
+	resp, err := r.packageHandler.GetCallGraphDiff(name, baseRef, headRef)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 
-	// API group for versioning
-	v1 := router.Group("/api/v1")
-	{
-		// Hello endpoint
-		v1.GET("/hello/:input", r.helloHandler)
+	// Render the diff as a graph when requested
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"response": resp,
+		})
+	case "dot":
+		c.JSON(http.StatusOK, gin.H{
+			"response": resp.DOT(),
+		})
+	case "mermaid":
+		c.JSON(http.StatusOK, gin.H{
+			"response": resp.Mermaid(),
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown format, expected json, dot or mermaid",
+		})
+	}
+}
 
-		// Clone repository endpoint
-		v1.POST("/clone", r.cloneRepo)
+// getArchitectureViolations
+func (r Router) getArchitectureViolations(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
 
-		v1.GET("/file/:name", r.addPath)
+	resp, err := r.packageHandler.CheckArchitecture(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getAPISurface
+func (r Router) getAPISurface(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetAPISurface(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getAPIDiff
+func (r Router) getAPIDiff(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	baseRef := c.Query("base")
+	if baseRef == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing base query parameter",
+		})
+		return
+	}
+
+	// Without a head ref the package is compared as it was loaded
+	headRef := c.Query("head")
+
+	resp, err := r.packageHandler.GetAPIDiff(name, baseRef, headRef)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getFieldUsage
+func (r Router) getFieldUsage(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	typeName := c.Query("type")
+	if typeName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing type query parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetFieldUsage(name, typeName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getDesignMetrics
+func (r Router) getDesignMetrics(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetDesignMetrics(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getClones
+func (r Router) getClones(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the minimum clone size parameter (optional)
+	minLines := utils.DefaultCloneMinLines
+	if minLinesStr := c.Query("minlines"); minLinesStr != "" {
+		parsed, err := strconv.Atoi(minLinesStr)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid minlines query parameter",
+			})
+			return
+		}
+		minLines = parsed
+	}
+
+	resp, err := r.packageHandler.GetClones(name, minLines)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getHotspots
+func (r Router) getHotspots(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the history window parameter (optional, e.g. "6 months ago")
+	since := c.Query("since")
+
+	resp, err := r.packageHandler.GetHotspots(name, since)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getFunctionOwnership
+func (r Router) getFunctionOwnership(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the file path parameter (optional, all files by default)
+	filePath := c.Query("filepath")
+
+	resp, err := r.packageHandler.GetFunctionOwnership(name, filePath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getFunctionHistory
+func (r Router) getFunctionHistory(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	filePath := c.Query("filepath")
+	if filePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing filepath query parameter",
+		})
+		return
+	}
+
+	function := c.Query("function")
+	if function == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing function query parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetFunctionHistory(name, filePath, function)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getBlame
+func (r Router) getBlame(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	filePath := c.Query("filepath")
+	if filePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing filepath query parameter",
+		})
+		return
+	}
+
+	// Get the ignore revs file parameter (optional, relative to the repository root)
+	ignoreRevsFile := c.Query("ignorerevs")
+
+	resp, err := r.packageHandler.GetBlame(name, filePath, ignoreRevsFile)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getCommitLog
+func (r Router) getCommitLog(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the page size parameter (optional)
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid limit query parameter",
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	// All filters are optional
+	filter := utils.CommitFilter{
+		Author: c.Query("author"),
+		Path:   c.Query("path"),
+		Since:  c.Query("since"),
+		Until:  c.Query("until"),
+		Grep:   c.Query("grep"),
+		Merges: c.Query("merges"),
+	}
+
+	resp, err := r.packageHandler.GetCommitLog(name, c.Query("cursor"), limit, filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getCommitDetail
+func (r Router) getCommitDetail(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	sha := c.Param("sha")
+	if sha == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path sha parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetCommitDetail(name, sha)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getRefs
+func (r Router) getRefs(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetRefs(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getIdentities
+func (r Router) getIdentities(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetIdentities(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getActivity
+func (r Router) getActivity(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the granularity parameter (optional, day, week or month)
+	granularity := c.DefaultQuery("granularity", utils.GranularityWeek)
+
+	// All filters are optional
+	filter := utils.ActivityFilter{
+		Path:   c.Query("path"),
+		Author: c.Query("author"),
+		Since:  c.Query("since"),
+		Until:  c.Query("until"),
+	}
+
+	resp, err := r.packageHandler.GetActivity(name, granularity, filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getChangeCoupling
+func (r Router) getChangeCoupling(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the history window parameter (optional, e.g. "6 months ago")
+	since := c.Query("since")
+
+	// Get the coupling thresholds (optional)
+	minSupport := utils.DefaultCouplingMinSupport
+	if minSupportStr := c.Query("minsupport"); minSupportStr != "" {
+		parsed, err := strconv.Atoi(minSupportStr)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid minsupport query parameter",
+			})
+			return
+		}
+		minSupport = parsed
+	}
+
+	minStrength := utils.DefaultCouplingMinStrength
+	if minStrengthStr := c.Query("minstrength"); minStrengthStr != "" {
+		parsed, err := strconv.ParseFloat(minStrengthStr, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid minstrength query parameter",
+			})
+			return
+		}
+		minStrength = parsed
+	}
+
+	resp, err := r.packageHandler.GetChangeCoupling(name, since, minSupport, minStrength)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getBusFactor
+func (r Router) getBusFactor(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// Get the depth parameter (optional)
+	depthStr := c.Query("depth")
+	depth := -1 // -1 means unlimited depth
+	if depthStr != "" {
+		parsedDepth, err := strconv.Atoi(depthStr)
+		if err == nil && parsedDepth >= 0 {
+			depth = parsedDepth
+		}
+	}
+
+	// Get the inactivity threshold of main authors (optional)
+	staleDays := utils.DefaultStaleDays
+	if staleDaysStr := c.Query("staledays"); staleDaysStr != "" {
+		parsed, err := strconv.Atoi(staleDaysStr)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid staledays query parameter",
+			})
+			return
+		}
+		staleDays = parsed
+	}
+
+	resp, err := r.packageHandler.GetBusFactor(name, depth, staleDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getLineCounts
+func (r Router) getLineCounts(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetLineCounts(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// refreshPackage
+func (r Router) refreshPackage(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	// The body is optional
+	var req RefreshRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request body",
+			})
+			return
+		}
+	}
+
+	resp, err := r.packageHandler.Refresh(name, req.Ref, req.Token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// startCloneJob
+func (r Router) startCloneJob(c *gin.Context) {
+	var req CloneRepoRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.StartCloneJob(req.RepoURL, req.FolderName, req.CloneOptions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"response": resp,
+	})
+}
+
+// startRegisterJob
+func (r Router) startRegisterJob(c *gin.Context) {
+	name := c.Param("name")
+
+	filePath := c.Query("filepath")
+	if filePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing filepath query parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.StartRegisterJob(filePath, name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"response": resp,
+	})
+}
+
+// getJobs
+func (r Router) getJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"response": r.packageHandler.GetJobs(),
+	})
+}
+
+// getJob
+func (r Router) getJob(c *gin.Context) {
+	resp, err := r.packageHandler.GetJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// cancelJob
+func (r Router) cancelJob(c *gin.Context) {
+	resp, err := r.packageHandler.CancelJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// streamJob streams the progress of a job as server-sent events. Earlier events are
+// replayed first and a final done event carries the finished job.
+func (r Router) streamJob(c *gin.Context) {
+	id := c.Param("id")
+	job, events, unsubscribe, err := r.packageHandler.SubscribeJob(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer unsubscribe()
+
+	for _, event := range job.Events {
+		c.SSEvent("progress", event)
+	}
+	if events == nil {
+		c.SSEvent("done", job)
+		return
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if job, err := r.packageHandler.GetJob(id); err == nil {
+					c.SSEvent("done", job)
+				}
+				return false
+			}
+			c.SSEvent("progress", event)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// getPackages
+func (r Router) getPackages(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"response": r.packageHandler.ListPackages(),
+	})
+}
+
+// createPackage
+func (r Router) createPackage(c *gin.Context) {
+	var req PackageRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid request body",
+		})
+		return
+	}
+	if req.Name == "" || req.FilePath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing name or filepath",
+		})
+		return
+	}
+
+	if _, err := r.packageHandler.addPackage(req.FilePath, req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetPackage(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// getPackage
+func (r Router) getPackage(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.GetPackage(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// reloadPackage
+func (r Router) reloadPackage(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	resp, err := r.packageHandler.ReloadPackage(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": resp,
+	})
+}
+
+// deletePackage
+func (r Router) deletePackage(c *gin.Context) {
+	name := c.Param("package")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing path package parameter",
+		})
+		return
+	}
+
+	if err := r.packageHandler.RemovePackage(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"response": "Success",
+	})
+}
+
+// streamChanges streams a change event whenever a package was brought up to date with
+// edited files, optionally only for the package of the package query parameter
+func (r Router) streamChanges(c *gin.Context) {
+	name := c.Query("package")
+	events, unsubscribe := r.packageHandler.SubscribeChanges()
+	defer unsubscribe()
+
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			if name == "" || event.Package == name {
+				c.SSEvent("change", event)
+			}
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// resolveRef points the package path parameter at a snapshot of the package when a
+// ref query parameter selects a branch, tag or commit
+func (r Router) resolveRef(c *gin.Context) {
+	name := c.Param("package")
+	ref := c.Query("ref")
+	if name == "" || ref == "" {
+		c.Next()
+		return
+	}
+
+	snapshot, err := r.packageHandler.ResolvePackage(name, ref)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	for i := range c.Params {
+		if c.Params[i].Key == "package" {
+			c.Params[i].Value = snapshot
+		}
+	}
+	c.Next()
+}
+
+// Router setup
+func SetupRouter() *gin.Engine {
+	// Create a default gin router with default middleware
+	router := gin.Default()
+
+	// Add CORS middleware
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowMethods:     []string{"GET", "POST", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		ExposeHeaders:    []string{"Content-Length"},
+		AllowCredentials: true,
+	}))
+
+	r := NewRouter()
+
+	// API group for versioning
+	v1 := router.Group("/api/v1")
+	{
+		// Hello endpoint
+		v1.GET("/hello/:input", r.helloHandler)
+
+		// Clone repository endpoint
+		v1.POST("/clone", r.cloneRepo)
+
+		v1.GET("/file/:name", r.addPath)
+
+		// Any analysis can look at a branch, tag or commit with ?ref=
+		analysis := v1.Group("")
+		analysis.Use(r.resolveRef)
+
+		analysis.GET("/treestructure/:package", r.getTreeStructure)
+
+		analysis.GET("/gitstats/:package", r.getGitStats)
+
+		analysis.GET("/lintissues/:package", r.getLintIssues)
+
+		analysis.GET("/functions/:package", r.getFunctions)
+
+		analysis.GET("/filestats/:package", r.getFileContributions)
+
+		analysis.GET("/filecontent/:package", r.getFileContent)
+
+		analysis.GET("/codeflow/:package", r.getCodeFlow)
+
+		analysis.GET("/codecoverage/:package", r.getCodeCoverage)
+
+		analysis.GET("/callgraphdiff/:package", r.getCallGraphDiff)
+
+		analysis.GET("/architecture/:package", r.getArchitectureViolations)
+
+		analysis.GET("/apisurface/:package", r.getAPISurface)
+
+		analysis.GET("/apidiff/:package", r.getAPIDiff)
+
+		analysis.GET("/fieldusage/:package", r.getFieldUsage)
+
+		analysis.GET("/metrics/:package", r.getDesignMetrics)
+
+		analysis.GET("/clones/:package", r.getClones)
+
+		analysis.GET("/hotspots/:package", r.getHotspots)
+
+		analysis.GET("/ownership/:package", r.getFunctionOwnership)
+
+		analysis.GET("/functionhistory/:package", r.getFunctionHistory)
+
+		analysis.GET("/blame/:package", r.getBlame)
+
+		analysis.GET("/commits/:package", r.getCommitLog)
+
+		analysis.GET("/commit/:package/:sha", r.getCommitDetail)
+
+		analysis.GET("/refs/:package", r.getRefs)
+
+		analysis.GET("/identities/:package", r.getIdentities)
+
+		analysis.GET("/activity/:package", r.getActivity)
+
+		analysis.GET("/coupling/:package", r.getChangeCoupling)
+
+		analysis.GET("/busfactor/:package", r.getBusFactor)
+
+		analysis.GET("/linecount/:package", r.getLineCounts)
+
+		v1.POST("/refresh/:package", r.refreshPackage)
+
+		// Background clone and registration jobs
+		v1.POST("/jobs/clone", r.startCloneJob)
+
+		v1.POST("/jobs/register/:name", r.startRegisterJob)
+
+		v1.GET("/jobs", r.getJobs)
+
+		v1.GET("/jobs/:id", r.getJob)
 
-		v1.GET("/treestructure/:package", r.getTreeStructure)
+		v1.GET("/jobs/:id/events", r.streamJob)
 
-		v1.GET("/gitstats/:package", r.getGitStats)
+		v1.POST("/jobs/:id/cancel", r.cancelJob)
 
-		v1.GET("/lintissues/:package", r.getLintIssues)
+		// Registered packages
+		v1.GET("/packages", r.getPackages)
 
-		v1.GET("/functions/:package", r.getFunctions)
+		v1.POST("/packages", r.createPackage)
 
-		v1.GET("/filestats/:package", r.getFileContributions)
+		v1.GET("/packages/:package", r.getPackage)
 
-		v1.GET("/filecontent/:package", r.getFileContent)
+		v1.POST("/packages/:package/reload", r.reloadPackage)
 
-		v1.GET("/codeflow/:package", r.getCodeFlow)
+		v1.DELETE("/packages/:package", r.deletePackage)
 
-		v1.GET("/codecoverage/:package", r.getCodeCoverage)
+		// Changes picked up by watching the package directories
+		v1.GET("/changes/events", r.streamChanges)
 	}
 
 	return router
@@ -0,0 +1,198 @@
+package logic
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"tbd.com/utils"
+)
+
+// snapshotsDir is the directory, relative to the working directory, holding the worktrees
+// of package snapshots. Go tools skip it since its name starts with a dot.
+const snapshotsDir = ".codeviz-snapshots"
+
+// maxSnapshotsEnv sets how many snapshots stay loaded
+const maxSnapshotsEnv = "CODEVIZ_MAX_SNAPSHOTS"
+
+// defaultMaxSnapshots is how many snapshots stay loaded when no limit is configured
+const defaultMaxSnapshots = 4
+
+// packageSubdir locates the package inside its git repository and returns the
+// repository root and the package directory relative to it
+func (p PackageManager) packageSubdir() (string, string, error) {
+	repoRoot, err := utils.RepoRoot(p.dirPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	realDir, err := filepath.EvalSymlinks(p.dirPath)
+	if err != nil {
+		return "", "", err
+	}
+	relDir, err := filepath.Rel(repoRoot, realDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	return repoRoot, relDir, nil
+}
+
+// Snapshot loads the package as it is at a commit. The commit is checked out into a
+// read-only worktree of its own, so the package's clone is never touched and the
+// worktree is reused for as long as it exists.
+func (p PackageManager) Snapshot(commit string) (PackageManager, error) {
+	repoRoot, relDir, err := p.packageSubdir()
+	if err != nil {
+		return PackageManager{}, err
+	}
+
+	snapshotRoot, err := filepath.Abs(snapshotsDir)
+	if err != nil {
+		return PackageManager{}, err
+	}
+	worktreeDir := filepath.Join(snapshotRoot, p.name+"-"+commit)
+	if head, err := utils.ResolveRef(worktreeDir, "HEAD"); err != nil || head != commit {
+		// Leftovers of an interrupted checkout are replaced
+		utils.RemoveWorktree(repoRoot, worktreeDir)
+		os.RemoveAll(worktreeDir)
+
+		if err := os.MkdirAll(snapshotRoot, 0755); err != nil {
+			return PackageManager{}, err
+		}
+		if err := utils.AddWorktree(repoRoot, commit, worktreeDir); err != nil {
+			return PackageManager{}, err
+		}
+		if err := makeReadOnly(worktreeDir); err != nil {
+			return PackageManager{}, err
+		}
+	}
+
+	snapshot, err := NewPackageManager(p.name+"@"+commit, filepath.Join(worktreeDir, relDir))
+	if err != nil {
+		return PackageManager{}, fmt.Errorf("failed to load %s at %s: %w", p.name, commit, err)
+	}
+	snapshot.origin = p.dirPath
+	snapshot.worktree = worktreeDir
+
+	return snapshot, nil
+}
+
+// removeSnapshot deletes the worktree of a snapshot
+func (p PackageManager) removeSnapshot() {
+	if p.worktree == "" {
+		return
+	}
+	if repoRoot, err := utils.RepoRoot(p.origin); err == nil {
+		utils.RemoveWorktree(repoRoot, p.worktree)
+	}
+	os.RemoveAll(p.worktree)
+}
+
+// snapshotLimit reads how many snapshots stay loaded from the environment
+func snapshotLimit() int {
+	limit, err := strconv.Atoi(os.Getenv(maxSnapshotsEnv))
+	if err != nil || limit <= 0 {
+		return defaultMaxSnapshots
+	}
+	return limit
+}
+
+// removeSnapshotWorktrees deletes the snapshot worktrees left behind by a previous run
+// in the working directory, then prunes them from the repositories of the registered
+// packages
+func removeSnapshotWorktrees(registrations []PackageRegistration) {
+	if err := os.RemoveAll(snapshotsDir); err != nil {
+		fmt.Println("Warning: snapshots not removed:", err)
+		return
+	}
+
+	pruned := make(map[string]bool)
+	for _, registration := range registrations {
+		repoRoot, err := utils.RepoRoot(registration.Path)
+		if err != nil || pruned[repoRoot] {
+			continue
+		}
+		pruned[repoRoot] = true
+		if err := utils.PruneWorktrees(repoRoot); err != nil {
+			fmt.Println("Warning:", err)
+		}
+	}
+}
+
+// useSnapshot marks a snapshot as used and unloads the least recently used snapshots
+// beyond the limit, removing their worktrees
+func (p *PackageHandler) useSnapshot(name string) {
+	p.mu.Lock()
+	p.snapshotUses[name] = time.Now()
+	evicted := []*packageEntry{}
+	for len(p.snapshotUses) > p.maxSnapshots {
+		oldest := ""
+		for snapshotName, usedAt := range p.snapshotUses {
+			if oldest == "" || usedAt.Before(p.snapshotUses[oldest]) {
+				oldest = snapshotName
+			}
+		}
+		delete(p.snapshotUses, oldest)
+		if entry, ok := p.packages[oldest]; ok {
+			delete(p.packages, oldest)
+			evicted = append(evicted, entry)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, entry := range evicted {
+		p.settle(entry)
+		if entry.pm.cache == nil {
+			continue
+		}
+		entry.pm.cache.invalidate()
+		entry.pm.removeSnapshot()
+	}
+}
+
+// makeReadOnly removes write permission from every file below dir. Directories stay
+// writable so analyses can still store their results next to the sources.
+func makeReadOnly(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return os.Chmod(path, info.Mode().Perm()&^0222)
+	})
+}
+
+// resolvePath maps a path inside the package a snapshot was taken from onto the same
+// path inside the snapshot. Relative paths stay relative to the working directory and
+// paths of regular packages are returned unchanged.
+func (p PackageManager) resolvePath(filePath string) string {
+	if p.origin == "" {
+		return filePath
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return filePath
+	}
+	relPath, err := filepath.Rel(p.origin, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return filePath
+	}
+
+	resolved := filepath.Join(p.dirPath, relPath)
+	if !filepath.IsAbs(filePath) {
+		if cwd, err := os.Getwd(); err == nil {
+			if relResolved, err := filepath.Rel(cwd, resolved); err == nil {
+				return relResolved
+			}
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,180 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"tbd.com/utils"
+)
+
+// watchIntervalEnv sets how often registered directories are polled for changes.
+// Watching is off unless it is set.
+const watchIntervalEnv = "CODEVIZ_WATCH_INTERVAL"
+
+// ChangeEvent tells clients that a package was brought up to date with edited files
+type ChangeEvent struct {
+	Package  string             `json:"package"`
+	Files    []utils.FileChange `json:"files"`
+	Reloaded []string           `json:"reloaded"` // Go packages type-checked again
+	Error    string             `json:"error,omitempty"`
+	Time     time.Time          `json:"time"`
+}
+
+// watchedPackage is the last scan of a package's files and the load it belongs to
+type watchedPackage struct {
+	loadedAt  time.Time
+	stamps    map[string]utils.FileStamp
+	lastError string // Why reloading the changes failed, published once
+}
+
+// changeFeed fans change events out to subscribers
+type changeFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan ChangeEvent]bool
+}
+
+// newChangeFeed creates a feed without subscribers
+func newChangeFeed() *changeFeed {
+	return &changeFeed{
+		subscribers: make(map[chan ChangeEvent]bool),
+	}
+}
+
+// publish sends an event to every subscriber. Slow subscribers miss events rather than
+// holding up the watcher.
+func (f *changeFeed) publish(event ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event.Time = time.Now()
+	for subscriber := range f.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel receiving the following events and a function to stop
+func (f *changeFeed) subscribe() (chan ChangeEvent, func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	events := make(chan ChangeEvent, 64)
+	f.subscribers[events] = true
+	unsubscribe := func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.subscribers[events] {
+			delete(f.subscribers, events)
+			close(events)
+		}
+	}
+	return events, unsubscribe
+}
+
+// watchInterval reads the polling interval from the environment. Zero disables watching.
+func watchInterval() time.Duration {
+	value := os.Getenv(watchIntervalEnv)
+	if value == "" {
+		return 0
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return 0
+	}
+	return interval
+}
+
+// watch polls the directories of the loaded packages until the process exits
+func (p *PackageHandler) watch(interval time.Duration) {
+	watched := make(map[string]watchedPackage)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.pollChanges(watched)
+	}
+}
+
+// pollChanges scans the files of every ready package and reloads the packages whose Go
+// files changed since the previous scan. A package not seen before, or reloaded by
+// something else, is compared with the files as they were when it was loaded. Changes
+// that failed to reload are retried on the next poll.
+func (p *PackageHandler) pollChanges(watched map[string]watchedPackage) {
+	ready := p.readyPackages()
+	for name := range watched {
+		if _, ok := ready[name]; !ok {
+			delete(watched, name)
+		}
+	}
+
+	for name, pm := range ready {
+		stamps, err := pm.scanSourceFiles()
+		if err != nil {
+			continue
+		}
+
+		previous, ok := watched[name]
+		if !ok || !previous.loadedAt.Equal(pm.loadedAt) {
+			if pm.stamps == nil {
+				// The files could not be scanned when loading
+				watched[name] = watchedPackage{loadedAt: pm.loadedAt, stamps: stamps}
+				continue
+			}
+			previous = watchedPackage{loadedAt: pm.loadedAt, stamps: pm.stamps}
+			watched[name] = previous
+		}
+		changes := utils.DiffFileStamps(previous.stamps, stamps)
+		if len(changes) == 0 {
+			continue
+		}
+
+		event := ChangeEvent{Package: name, Files: changes, Reloaded: []string{}}
+		reloaded, err := p.reloadOnce(name, func(previous PackageManager, path string) (PackageManager, error) {
+			pm, pkgPaths, err := previous.ReloadChanged(changes, stamps)
+			event.Reloaded = pkgPaths
+			return pm, err
+		})
+		if errors.Is(err, errPackageBusy) {
+			// Looked at again on the next poll
+			continue
+		}
+		if err != nil {
+			// Keep the previous scan so the changes are looked at again
+			if err.Error() == previous.lastError {
+				continue
+			}
+			fmt.Println("Warning:", err)
+			event.Error = err.Error()
+			previous.lastError = event.Error
+			watched[name] = previous
+		} else {
+			watched[name] = watchedPackage{loadedAt: reloaded.loadedAt, stamps: stamps}
+		}
+		p.changes.publish(event)
+	}
+}
+
+// readyPackages returns the loaded packages that can be watched. Snapshots are left out
+// since they are tied to commits.
+func (p *PackageHandler) readyPackages() map[string]PackageManager {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ready := make(map[string]PackageManager)
+	for name, entry := range p.packages {
+		if entry.state == PackageReady && entry.pm.origin == "" {
+			ready[name] = entry.pm
+		}
+	}
+	return ready
+}
+
+// SubscribeChanges returns a channel of the following change events of every package
+func (p *PackageHandler) SubscribeChanges() (chan ChangeEvent, func()) {
+	return p.changes.subscribe()
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Granularities of an activity time series
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// ActivityFilter restricts the commits counted by GetActivity. Empty fields match everything.
+type ActivityFilter struct {
+	Path   string // File or directory the commits must touch
+	Author string // Case-insensitive substring of the canonical author name or email
+	Since  string // Earliest commit date, anything git log --since accepts
+	Until  string // Latest commit date, anything git log --until accepts
+}
+
+// ActivityPoint contains the activity of one period, named by the date it starts on
+type ActivityPoint struct {
+	Period       string `json:"period"`
+	Commits      int    `json:"commits"`
+	LinesAdded   int    `json:"linesAdded"`
+	LinesDeleted int    `json:"linesDeleted"`
+	Authors      int    `json:"authors"`
+}
+
+// ActivityReport contains a time series of commit activity and a commit heatmap.
+// Heatmap rows are weekdays from Sunday to Saturday and columns are hours of the
+// day, both in the author's time zone.
+type ActivityReport struct {
+	Granularity string          `json:"granularity"`
+	Path        string          `json:"path,omitempty"`
+	Author      string          `json:"author,omitempty"`
+	Series      []ActivityPoint `json:"series"`
+	Heatmap     [7][24]int      `json:"heatmap"`
+}
+
+// GetActivity counts commits and changed lines per period for the history below
+// repoPath. Periods without commits are included up to the current one, so
+// components that went cold show up as a flat line.
+func GetActivity(repoPath, granularity string, filter ActivityFilter, rules IdentityRules) (ActivityReport, error) {
+	if granularity != GranularityDay && granularity != GranularityWeek && granularity != GranularityMonth {
+		return ActivityReport{}, fmt.Errorf("invalid granularity: %s", granularity)
+	}
+
+	args := []string{"log", "--numstat", "--no-renames", "--relative",
+		"--date=format:%Y-%m-%d %w %H", "--format=%x00%aN%x00%aE%x00%ad"}
+	if filter.Since != "" {
+		args = append(args, "--since="+filter.Since)
+	}
+	if filter.Until != "" {
+		args = append(args, "--until="+filter.Until)
+	}
+	path := filter.Path
+	if path == "" {
+		path = "."
+	}
+	args = append(args, "--", path)
+
+	logOutput, err := execGitCommand(repoPath, args...)
+	if err != nil {
+		return ActivityReport{}, fmt.Errorf("failed to get git log: %w", err)
+	}
+
+	report := ActivityReport{
+		Granularity: granularity,
+		Path:        filter.Path,
+		Author:      filter.Author,
+		Series:      []ActivityPoint{},
+	}
+	points := make(map[time.Time]*ActivityPoint)
+	authors := make(map[time.Time]map[string]bool)
+	var current *ActivityPoint
+
+	for _, line := range strings.Split(logOutput, "\n") {
+		if strings.HasPrefix(line, "\x00") {
+			current = nil
+			fields := strings.Split(line[1:], "\x00")
+			if len(fields) != 3 {
+				continue
+			}
+
+			name, email := rules.Canonical(fields[0], fields[1])
+			if rules.Excluded(name, email) || !matchesAuthor(filter.Author, name, email) {
+				continue
+			}
+
+			// <date> <weekday> <hour>
+			dateFields := strings.Fields(fields[2])
+			if len(dateFields) != 3 {
+				continue
+			}
+			date, err := time.Parse("2006-01-02", dateFields[0])
+			if err != nil {
+				continue
+			}
+			weekday, _ := strconv.Atoi(dateFields[1])
+			hour, _ := strconv.Atoi(dateFields[2])
+			report.Heatmap[weekday%7][hour%24]++
+
+			period := periodStart(date, granularity)
+			if points[period] == nil {
+				points[period] = &ActivityPoint{Period: period.Format("2006-01-02")}
+				authors[period] = make(map[string]bool)
+			}
+			current = points[period]
+			current.Commits++
+			authors[period][strings.ToLower(email)] = true
+			continue
+		}
+
+		// <additions>\t<deletions>\t<path>, with "-" counts for binary files
+		parts := strings.Split(line, "\t")
+		if current == nil || len(parts) != 3 {
+			continue
+		}
+		added, _ := strconv.Atoi(parts[0])
+		deleted, _ := strconv.Atoi(parts[1])
+		current.LinesAdded += added
+		current.LinesDeleted += deleted
+	}
+
+	if len(points) == 0 {
+		return report, nil
+	}
+
+	first, last := time.Time{}, periodStart(time.Now().UTC(), granularity)
+	for period := range points {
+		if first.IsZero() || period.Before(first) {
+			first = period
+		}
+		if period.After(last) {
+			last = period
+		}
+	}
+	for period := first; !period.After(last); period = nextPeriod(period, granularity) {
+		point := ActivityPoint{Period: period.Format("2006-01-02")}
+		if points[period] != nil {
+			point = *points[period]
+			point.Authors = len(authors[period])
+		}
+		report.Series = append(report.Series, point)
+	}
+
+	return report, nil
+}
+
+// matchesAuthor reports whether a contributor matches an author filter
+func matchesAuthor(filter, name, email string) bool {
+	if filter == "" {
+		return true
+	}
+	filter = strings.ToLower(filter)
+	return strings.Contains(strings.ToLower(name), filter) || strings.Contains(strings.ToLower(email), filter)
+}
+
+// periodStart returns the first day of the period containing date. Weeks start on Monday.
+func periodStart(date time.Time, granularity string) time.Time {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch granularity {
+	case GranularityWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case GranularityMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+// nextPeriod returns the start of the period following the one starting at period
+func nextPeriod(period time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return period.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return period.AddDate(0, 1, 0)
+	}
+	return period.AddDate(0, 0, 1)
+}
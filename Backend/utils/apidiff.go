@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// APIChange represents a single difference between two versions of a module's API
+type APIChange struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Change     string `json:"change"` // added, removed or changed
+	Compatible bool   `json:"compatible"`
+	Before     string `json:"before,omitempty"`
+	After      string `json:"after,omitempty"`
+	Message    string `json:"message"`
+}
+
+// APIDiff contains the classified changes between two API surfaces and the
+// semantic version bump they call for
+type APIDiff struct {
+	BaseRef          string      `json:"baseRef"`
+	HeadRef          string      `json:"headRef"`
+	Changes          []APIChange `json:"changes"`
+	Breaking         int         `json:"breaking"`
+	Compatible       int         `json:"compatible"`
+	CurrentVersion   string      `json:"currentVersion,omitempty"`
+	SuggestedBump    string      `json:"suggestedBump"` // major, minor or patch
+	SuggestedVersion string      `json:"suggestedVersion,omitempty"`
+}
+
+// DiffAPISurfaces classifies every change from the base API to the head API following
+// the rules of golang.org/x/exp/apidiff: removing or changing an element breaks
+// clients, adding one does not, except for methods added to an interface
+func DiffAPISurfaces(base, head []APIElement) APIDiff {
+	before := make(map[string]APIElement, len(base))
+	for _, element := range base {
+		before[element.Key()] = element
+	}
+	after := make(map[string]APIElement, len(head))
+	for _, element := range head {
+		after[element.Key()] = element
+	}
+
+	diff := APIDiff{Changes: []APIChange{}}
+
+	for key, element := range after {
+		old, existed := before[key]
+		switch {
+		case !existed:
+			change := APIChange{
+				Kind:       element.Kind,
+				Name:       key,
+				Change:     "added",
+				Compatible: true,
+				After:      element.Signature,
+				Message:    fmt.Sprintf("%s %s added", element.Kind, key),
+			}
+			if element.Kind == "interfacemethod" {
+				change.Compatible = false
+				change.Message = fmt.Sprintf("method %s added to interface; existing implementations no longer satisfy it", key)
+			}
+			diff.Changes = append(diff.Changes, change)
+
+		case old.shape != element.shape || old.Kind != element.Kind:
+			diff.Changes = append(diff.Changes, APIChange{
+				Kind:       element.Kind,
+				Name:       key,
+				Change:     "changed",
+				Compatible: false,
+				Before:     old.Signature,
+				After:      element.Signature,
+				Message:    fmt.Sprintf("%s %s changed from %q to %q", element.Kind, key, old.Signature, element.Signature),
+			})
+		}
+	}
+
+	for key, element := range before {
+		if _, exists := after[key]; !exists {
+			diff.Changes = append(diff.Changes, APIChange{
+				Kind:       element.Kind,
+				Name:       key,
+				Change:     "removed",
+				Compatible: false,
+				Before:     element.Signature,
+				Message:    fmt.Sprintf("%s %s removed", element.Kind, key),
+			})
+		}
+	}
+
+	sort.Slice(diff.Changes, func(i, j int) bool {
+		return diff.Changes[i].Name < diff.Changes[j].Name
+	})
+
+	for _, change := range diff.Changes {
+		if change.Compatible {
+			diff.Compatible++
+		} else {
+			diff.Breaking++
+		}
+	}
+
+	switch {
+	case diff.Breaking > 0:
+		diff.SuggestedBump = "major"
+	case diff.Compatible > 0:
+		diff.SuggestedBump = "minor"
+	default:
+		diff.SuggestedBump = "patch"
+	}
+
+	return diff
+}
+
+// SuggestVersion fills in the next version for the suggested bump, starting from
+// the given current version. Modules below v1 make no compatibility promise, so
+// breaking changes only bump their minor version.
+func (d *APIDiff) SuggestVersion(current string) {
+	if !semver.IsValid(current) {
+		return
+	}
+	d.CurrentVersion = current
+
+	var major, minor, patch int
+	fmt.Sscanf(strings.TrimPrefix(semver.Canonical(current), "v"), "%d.%d.%d", &major, &minor, &patch)
+
+	bump := d.SuggestedBump
+	if bump == "major" && major == 0 {
+		bump = "minor"
+	}
+
+	switch bump {
+	case "major":
+		d.SuggestedVersion = fmt.Sprintf("v%d.0.0", major+1)
+	case "minor":
+		d.SuggestedVersion = fmt.Sprintf("v%d.%d.0", major, minor+1)
+	default:
+		d.SuggestedVersion = fmt.Sprintf("v%d.%d.%d", major, minor, patch+1)
+	}
+}
+
+// LatestVersionTag returns the most recent semantic version tag reachable from HEAD
+func LatestVersionTag(repoPath string) string {
+	out, err := execGitCommand(repoPath, "describe", "--tags", "--abbrev=0", "--match", "v[0-9]*")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
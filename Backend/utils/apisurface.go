@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// APIElement represents a single exported identifier of a module's public API
+type APIElement struct {
+	Kind      string `json:"kind"` // type, func, method, field, interfacemethod, const or var
+	Package   string `json:"package"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Doc       string `json:"doc,omitempty"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	shape     string // signature without parameter names, used for comparisons
+}
+
+// Key identifies the element across snapshots of the same module
+func (e APIElement) Key() string {
+	return e.Package + "." + e.Name
+}
+
+// APISurface lists every exported type, function, method, field, constant and variable
+// of the loaded packages. Main packages and internal packages are not part of the API.
+func (ca *CallGraphAnalyzer) APISurface() []APIElement {
+	elements := []APIElement{}
+
+	for _, pkgPath := range ca.PackagePaths() {
+		pkg := ca.pkgs[pkgPath]
+		if pkg.Types == nil || pkg.Name == "main" || isInternalPackage(pkgPath) {
+			continue
+		}
+
+		docs := declarationDocs(pkg.Syntax)
+		qualifier := types.RelativeTo(pkg.Types)
+		scope := pkg.Types.Scope()
+
+		newElement := func(kind, name, signature, shape string, pos token.Pos) APIElement {
+			position := ca.fset.Position(pos)
+			return APIElement{
+				Kind:      kind,
+				Package:   pkgPath,
+				Name:      name,
+				Signature: signature,
+				Doc:       docs[pos],
+				File:      ca.relativePath(position.Filename),
+				Line:      position.Line,
+				shape:     shape,
+			}
+		}
+
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if !obj.Exported() {
+				continue
+			}
+
+			switch obj := obj.(type) {
+			case *types.Func:
+				sig := obj.Type().(*types.Signature)
+				elements = append(elements, newElement("func", name,
+					"func "+name+strings.TrimPrefix(types.TypeString(sig, qualifier), "func"),
+					signatureShape(sig, qualifier), obj.Pos()))
+
+			case *types.Const:
+				signature := types.ObjectString(obj, qualifier) + " = " + obj.Val().ExactString()
+				elements = append(elements, newElement("const", name, signature, signature, obj.Pos()))
+
+			case *types.Var:
+				signature := types.ObjectString(obj, qualifier)
+				elements = append(elements, newElement("var", name, signature, signature, obj.Pos()))
+
+			case *types.TypeName:
+				signature := typeDeclString(obj, qualifier)
+				elements = append(elements, newElement("type", name, signature, signature, obj.Pos()))
+
+				if obj.IsAlias() {
+					continue
+				}
+				named, ok := obj.Type().(*types.Named)
+				if !ok {
+					continue
+				}
+
+				switch underlying := named.Underlying().(type) {
+				case *types.Struct:
+					for i := 0; i < underlying.NumFields(); i++ {
+						field := underlying.Field(i)
+						if !field.Exported() {
+							continue
+						}
+						signature := field.Name() + " " + types.TypeString(field.Type(), qualifier)
+						if field.Embedded() {
+							signature = types.TypeString(field.Type(), qualifier)
+						}
+						elements = append(elements, newElement("field", name+"."+field.Name(), signature, signature, field.Pos()))
+					}
+
+				case *types.Interface:
+					for i := 0; i < underlying.NumMethods(); i++ {
+						method := underlying.Method(i)
+						if !method.Exported() {
+							continue
+						}
+						sig := method.Type().(*types.Signature)
+						elements = append(elements, newElement("interfacemethod", name+"."+method.Name(),
+							method.Name()+strings.TrimPrefix(types.TypeString(sig, qualifier), "func"),
+							signatureShape(sig, qualifier), method.Pos()))
+					}
+				}
+
+				for i := 0; i < named.NumMethods(); i++ {
+					method := named.Method(i)
+					if !method.Exported() {
+						continue
+					}
+					sig := method.Type().(*types.Signature)
+					recv := types.TypeString(sig.Recv().Type(), qualifier)
+					elements = append(elements, newElement("method", name+"."+method.Name(),
+						"func ("+recv+") "+method.Name()+strings.TrimPrefix(types.TypeString(sig, qualifier), "func"),
+						recv+" "+signatureShape(sig, qualifier), method.Pos()))
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(elements, func(i, j int) bool {
+		return elements[i].Key() < elements[j].Key()
+	})
+
+	return elements
+}
+
+// isInternalPackage reports whether the import path contains an internal element
+func isInternalPackage(pkgPath string) bool {
+	for _, elem := range strings.Split(pkgPath, "/") {
+		if elem == "internal" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeDeclString describes a type declaration without listing struct fields or
+// interface methods, which are reported as elements of their own
+func typeDeclString(obj *types.TypeName, qualifier types.Qualifier) string {
+	if obj.IsAlias() {
+		return "type " + obj.Name() + " = " + types.TypeString(obj.Type(), qualifier)
+	}
+
+	switch underlying := obj.Type().Underlying().(type) {
+	case *types.Struct:
+		return "type " + obj.Name() + " struct"
+	case *types.Interface:
+		return "type " + obj.Name() + " interface"
+	default:
+		return "type " + obj.Name() + " " + types.TypeString(underlying, qualifier)
+	}
+}
+
+// signatureShape renders a signature with parameter and result names removed, so that
+// renaming a parameter is not reported as an API change
+func signatureShape(sig *types.Signature, qualifier types.Qualifier) string {
+	tupleShape := func(tuple *types.Tuple, variadic bool) string {
+		parts := make([]string, tuple.Len())
+		for i := 0; i < tuple.Len(); i++ {
+			t := tuple.At(i).Type()
+			if variadic && i == tuple.Len()-1 {
+				parts[i] = "..." + types.TypeString(t.(*types.Slice).Elem(), qualifier)
+			} else {
+				parts[i] = types.TypeString(t, qualifier)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+
+	return "func(" + tupleShape(sig.Params(), sig.Variadic()) + ") (" + tupleShape(sig.Results(), false) + ")"
+}
+
+// declarationDocs maps the position of every declared identifier to its doc comment
+func declarationDocs(files []*ast.File) map[token.Pos]string {
+	docs := make(map[token.Pos]string)
+	docText := func(groups ...*ast.CommentGroup) string {
+		for _, group := range groups {
+			if group != nil {
+				return strings.TrimSpace(group.Text())
+			}
+		}
+		return ""
+	}
+
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				docs[decl.Name.Pos()] = docText(decl.Doc)
+
+			case *ast.GenDecl:
+				// A lone spec inherits the doc comment of its declaration
+				var declDoc *ast.CommentGroup
+				if len(decl.Specs) == 1 {
+					declDoc = decl.Doc
+				}
+
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						docs[spec.Name.Pos()] = docText(spec.Doc, declDoc)
+
+						var fields *ast.FieldList
+						switch t := spec.Type.(type) {
+						case *ast.StructType:
+							fields = t.Fields
+						case *ast.InterfaceType:
+							fields = t.Methods
+						}
+						if fields == nil {
+							continue
+						}
+						for _, field := range fields.List {
+							for _, fieldName := range field.Names {
+								docs[fieldName.Pos()] = docText(field.Doc, field.Comment)
+							}
+							if len(field.Names) == 0 {
+								docs[embeddedNamePos(field.Type)] = docText(field.Doc, field.Comment)
+							}
+						}
+
+					case *ast.ValueSpec:
+						for _, valueName := range spec.Names {
+							docs[valueName.Pos()] = docText(spec.Doc, spec.Comment, declDoc)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return docs
+}
+
+// embeddedNamePos returns the position of the type name of an embedded field,
+// which is where go/types places the field object
+func embeddedNamePos(expr ast.Expr) token.Pos {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if index, ok := expr.(*ast.IndexExpr); ok {
+		expr = index.X
+	}
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		return sel.Sel.Pos()
+	}
+	return expr.Pos()
+}
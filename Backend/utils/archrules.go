@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ArchRulesFile is the name of the architecture rules file looked up in an analyzed project
+const ArchRulesFile = ".codeviz-arch.yml"
+
+// ArchRules is the declarative architecture description read from the rules file
+//
+//	layers:
+//	  - name: handlers
+//	    packages: ["handlers/..."]
+//	  - name: storage
+//	    packages: ["storage/..."]
+//	rules:
+//	  - from: handlers
+//	    allow: [services]
+//	  - from: utils
+//	    deny: [logic]
+type ArchRules struct {
+	Layers []ArchLayer `yaml:"layers" json:"layers"`
+	Rules  []ArchRule  `yaml:"rules" json:"rules"`
+}
+
+// ArchLayer groups packages by import path pattern. Patterns are relative to the
+// module path unless they are full import paths, and may end in "/..." to match subpackages
+type ArchLayer struct {
+	Name     string   `yaml:"name" json:"name"`
+	Packages []string `yaml:"packages" json:"packages"`
+}
+
+// ArchRule restricts the dependencies of a layer. When Allow is set, the layer may
+// only depend on itself and the listed layers; Deny forbids the listed layers outright
+type ArchRule struct {
+	From  string   `yaml:"from" json:"from"`
+	Allow []string `yaml:"allow,omitempty" json:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty" json:"deny,omitempty"`
+}
+
+// ArchViolation represents a single dependency that breaks an architecture rule
+type ArchViolation struct {
+	Kind      string `json:"kind"` // "import" or "call"
+	FromLayer string `json:"fromLayer"`
+	ToLayer   string `json:"toLayer"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Message   string `json:"message"`
+}
+
+// ArchReport contains the result of checking a project against its architecture rules
+type ArchReport struct {
+	RulesFile  string          `json:"rulesFile"`
+	Rules      ArchRules       `json:"rules"`
+	Violations []ArchViolation `json:"violations"`
+}
+
+// LoadArchRules reads and validates an architecture rules file
+func LoadArchRules(rulesPath string) (ArchRules, error) {
+	var rules ArchRules
+
+	data, err := os.ReadFile(rulesPath)
+	if err != nil {
+		return rules, fmt.Errorf("failed to read architecture rules: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("failed to parse architecture rules: %w", err)
+	}
+
+	layers := make(map[string]bool)
+	for _, layer := range rules.Layers {
+		if layer.Name == "" {
+			return rules, fmt.Errorf("architecture layer without a name")
+		}
+		layers[layer.Name] = true
+	}
+
+	for _, rule := range rules.Rules {
+		for _, name := range append(append([]string{rule.From}, rule.Allow...), rule.Deny...) {
+			if !layers[name] {
+				return rules, fmt.Errorf("architecture rule references unknown layer: %s", name)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// layerOf returns the first layer whose patterns match the package, or "" if none do
+func (r ArchRules) layerOf(pkgPath, modulePath string) string {
+	for _, layer := range r.Layers {
+		for _, pattern := range layer.Packages {
+			if matchPackagePattern(pattern, pkgPath, modulePath) {
+				return layer.Name
+			}
+		}
+	}
+	return ""
+}
+
+// violates reports whether a dependency from one layer onto another breaks a rule
+func (r ArchRules) violates(fromLayer, toLayer string) bool {
+	for _, rule := range r.Rules {
+		if rule.From != fromLayer {
+			continue
+		}
+		if slices.Contains(rule.Deny, toLayer) {
+			return true
+		}
+		if len(rule.Allow) > 0 && fromLayer != toLayer && !slices.Contains(rule.Allow, toLayer) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPackagePattern matches an import path against a layer pattern
+func matchPackagePattern(pattern, pkgPath, modulePath string) bool {
+	pattern = strings.TrimPrefix(pattern, "./")
+
+	// Patterns whose first element looks like a domain are full import paths
+	firstElem, _, _ := strings.Cut(pattern, "/")
+	if modulePath != "" && !strings.Contains(firstElem, ".") {
+		if pattern == "" {
+			pattern = modulePath
+		} else {
+			pattern = modulePath + "/" + pattern
+		}
+	}
+
+	if base, ok := strings.CutSuffix(pattern, "/..."); ok {
+		if pkgPath == base || strings.HasPrefix(pkgPath, base+"/") {
+			return true
+		}
+		pattern = base
+	}
+
+	matched, err := path.Match(pattern, pkgPath)
+	return err == nil && matched
+}
+
+// CheckArchitecture evaluates the rules against the import and call graphs of the analyzer
+func CheckArchitecture(ca *CallGraphAnalyzer, rules ArchRules, modulePath string) []ArchViolation {
+	violations := []ArchViolation{}
+
+	for _, edge := range ca.ImportEdges() {
+		fromLayer := rules.layerOf(edge.From, modulePath)
+		toLayer := rules.layerOf(edge.To, modulePath)
+		if fromLayer == "" || toLayer == "" {
+			continue
+		}
+
+		if rules.violates(fromLayer, toLayer) {
+			violations = append(violations, ArchViolation{
+				Kind:      "import",
+				FromLayer: fromLayer,
+				ToLayer:   toLayer,
+				From:      edge.From,
+				To:        edge.To,
+				File:      edge.File,
+				Line:      edge.Line,
+				Message:   fmt.Sprintf("%s (%s) must not import %s (%s)", edge.From, fromLayer, edge.To, toLayer),
+			})
+		}
+	}
+
+	for _, edge := range ca.CallEdges() {
+		fromPkg := ca.functionNodes[edge.Caller].Package
+		toPkg := ca.functionNodes[edge.Callee].Package
+		fromLayer := rules.layerOf(fromPkg, modulePath)
+		toLayer := rules.layerOf(toPkg, modulePath)
+		if fromLayer == "" || toLayer == "" {
+			continue
+		}
+
+		if rules.violates(fromLayer, toLayer) {
+			violations = append(violations, ArchViolation{
+				Kind:      "call",
+				FromLayer: fromLayer,
+				ToLayer:   toLayer,
+				From:      edge.Caller,
+				To:        edge.Callee,
+				File:      edge.File,
+				Line:      edge.Line,
+				Message:   fmt.Sprintf("%s (%s) must not call %s (%s)", edge.Caller, fromLayer, edge.Callee, toLayer),
+			})
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].File != violations[j].File {
+			return violations[i].File < violations[j].File
+		}
+		return violations[i].Line < violations[j].Line
+	})
+
+	return violations
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultIgnoreRevsFile is the conventional name of the file listing commits blame should skip
+const DefaultIgnoreRevsFile = ".git-blame-ignore-revs"
+
+// BlameLine represents the commit that last changed a single line of a file
+type BlameLine struct {
+	Line       int       `json:"line"`
+	OrigLine   int       `json:"origLine"`
+	OrigFile   string    `json:"origFile"`
+	Commit     string    `json:"commit"`
+	Author     string    `json:"author"`
+	Email      string    `json:"email"`
+	AuthorTime time.Time `json:"date"`
+	Summary    string    `json:"summary"`
+	Content    string    `json:"content"`
+	AgeDays    int       `json:"ageDays"`
+}
+
+// BlameOptions controls how git blame attributes lines
+type BlameOptions struct {
+	FollowCopies   bool   // Follow lines moved or copied within and across files
+	IgnoreRevsFile string // File listing commits to skip, such as mass reformatting
+}
+
+// FileBlame contains the blame of every line of a file
+type FileBlame struct {
+	File           string      `json:"file"`
+	IgnoreRevsFile string      `json:"ignoreRevsFile,omitempty"`
+	Lines          []BlameLine `json:"lines"`
+}
+
+// BlameFile runs git blame on a file and returns the origin of every line
+func BlameFile(repoPath, filePath string, options BlameOptions) ([]BlameLine, error) {
+	args := []string{"blame", "--line-porcelain"}
+	if options.FollowCopies {
+		args = append(args, "-M", "-C")
+	}
+	if options.IgnoreRevsFile != "" {
+		args = append(args, "--ignore-revs-file", options.IgnoreRevsFile)
+	}
+	args = append(args, "--", filePath)
+
+	output, err := execGitCommand(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git blame for file: %w", err)
+	}
+	return parseBlamePorcelain(output), nil
+}
+
+// parseBlamePorcelain parses the output of git blame --line-porcelain, in which every
+// line is preceded by a "<sha> <orig line> <final line>" header and the commit details
+func parseBlamePorcelain(output string) []BlameLine {
+	var lines []BlameLine
+	var current BlameLine
+	inHeader := false
+
+	for _, line := range strings.Split(output, "\n") {
+		// The line content ends the entry
+		if strings.HasPrefix(line, "\t") {
+			current.Content = line[1:]
+			lines = append(lines, current)
+			inHeader = false
+			continue
+		}
+
+		if !inHeader {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || len(fields[0]) < 40 {
+				continue
+			}
+			current = BlameLine{Commit: fields[0]}
+			current.OrigLine, _ = strconv.Atoi(fields[1])
+			current.Line, _ = strconv.Atoi(fields[2])
+			inHeader = true
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "author":
+			current.Author = value
+		case "author-mail":
+			current.Email = strings.Trim(value, "<>")
+		case "author-time":
+			seconds, _ := strconv.ParseInt(value, 10, 64)
+			current.AuthorTime = time.Unix(seconds, 0).UTC()
+		case "summary":
+			current.Summary = value
+		case "filename":
+			current.OrigFile = value
+		}
+	}
+
+	return lines
+}
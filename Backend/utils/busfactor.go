@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStaleDays is how long a main author may go without committing before the
+// knowledge they hold is considered at risk
+const DefaultStaleDays = 180
+
+// Bounds of the bus factor parameters. Deeper trees are walked without a depth limit and
+// authors away for longer are stale anyway.
+const (
+	MaxBusFactorDepth = 16
+	MaxStaleDays      = 3650
+)
+
+// KnowledgeShare is the part of the surviving lines an author last changed
+type KnowledgeShare struct {
+	Name       string  `json:"name"`
+	Email      string  `json:"email"`
+	Lines      int     `json:"lines"`
+	Pct        float64 `json:"percentage"`
+	LastCommit string  `json:"lastCommit,omitempty"`
+}
+
+// KnowledgeMap counts the surviving lines of every author, keyed by lowercase email
+type KnowledgeMap map[string]*KnowledgeShare
+
+// AddBlame credits every blamed line to its author, skipping excluded contributors
+func (k KnowledgeMap) AddBlame(blame []BlameLine, rules IdentityRules) {
+	for _, line := range blame {
+		if rules.Excluded(line.Author, line.Email) {
+			continue
+		}
+		k.add(line.Author, line.Email, 1)
+	}
+}
+
+// Merge adds the lines of another knowledge map
+func (k KnowledgeMap) Merge(other KnowledgeMap) {
+	for _, share := range other {
+		k.add(share.Name, share.Email, share.Lines)
+	}
+}
+
+// add credits lines to an author
+func (k KnowledgeMap) add(name, email string, lines int) {
+	key := strings.ToLower(email)
+	if k[key] == nil {
+		k[key] = &KnowledgeShare{Name: name, Email: email}
+	}
+	k[key].Lines += lines
+}
+
+// Shares returns the knowledge shares with their percentages, largest first
+func (k KnowledgeMap) Shares() []KnowledgeShare {
+	total := 0
+	for _, share := range k {
+		total += share.Lines
+	}
+
+	shares := make([]KnowledgeShare, 0, len(k))
+	for _, share := range k {
+		result := *share
+		if total > 0 {
+			result.Pct = math.Round(float64(share.Lines) / float64(total) * 100)
+		}
+		shares = append(shares, result)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Lines != shares[j].Lines {
+			return shares[i].Lines > shares[j].Lines
+		}
+		return shares[i].Email < shares[j].Email
+	})
+
+	return shares
+}
+
+// BusFactor returns the minimum number of authors who together own more than half
+// of the lines, given shares sorted largest first
+func BusFactor(shares []KnowledgeShare) int {
+	total := 0
+	for _, share := range shares {
+		total += share.Lines
+	}
+
+	owned := 0
+	for i, share := range shares {
+		owned += share.Lines
+		if owned*2 > total {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// LastCommitDates returns the date of the latest commit of every contributor in the
+// repository, keyed by lowercase canonical email
+func LastCommitDates(repoPath string, rules IdentityRules) (map[string]time.Time, error) {
+	logOutput, err := execGitCommand(repoPath, "log", "--all", "--format=%aN%x00%aE%x00%at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git log: %w", err)
+	}
+
+	dates := make(map[string]time.Time)
+	for _, line := range strings.Split(logOutput, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		_, email := rules.Canonical(fields[0], fields[1])
+		seconds, _ := strconv.ParseInt(fields[2], 10, 64)
+
+		key := strings.ToLower(email)
+		if date := time.Unix(seconds, 0).UTC(); date.After(dates[key]) {
+			dates[key] = date
+		}
+	}
+
+	return dates, nil
+}
+
+// TrackedFiles lists the files git tracks below repoPath, relative to repoPath
+func TrackedFiles(repoPath string) (map[string]bool, error) {
+	output, err := execGitCommand(repoPath, "-c", "core.quotepath=off", "ls-files")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git files: %w", err)
+	}
+
+	files := make(map[string]bool)
+	for _, file := range strings.Split(output, "\n") {
+		if file != "" {
+			files[file] = true
+		}
+	}
+	return files, nil
+}
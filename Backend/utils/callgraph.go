@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// CallEdge represents a single call site from one loaded function to another
+type CallEdge struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+}
+
+// Functions returns the fully qualified names of all registered functions, sorted
+func (ca *CallGraphAnalyzer) Functions() []string {
+	names := make([]string, 0, len(ca.functionNodes))
+	for name := range ca.functionNodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CallEdges resolves every call between registered functions using type information.
+// Calls to functions outside the loaded packages are skipped.
+func (ca *CallGraphAnalyzer) CallEdges() []CallEdge {
+	var edges []CallEdge
+	for _, pkgPath := range ca.PackagePaths() {
+		pkg := ca.pkgs[pkgPath]
+		if pkg.TypesInfo == nil {
+			continue
+		}
+
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if !ok || funcDecl.Body == nil {
+					continue
+				}
+				caller := pkg.PkgPath + "." + declaredFuncName(pkg, funcDecl)
+
+				ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+					callExpr, ok := n.(*ast.CallExpr)
+					if !ok {
+						return true
+					}
+
+					fn, ok := typeutil.Callee(pkg.TypesInfo, callExpr).(*types.Func)
+					if !ok {
+						return true
+					}
+
+					callee := funcObjectName(fn)
+					if _, exists := ca.functionNodes[callee]; !exists {
+						return true
+					}
+
+					position := ca.fset.Position(callExpr.Pos())
+					edges = append(edges, CallEdge{
+						Caller: caller,
+						Callee: callee,
+						File:   ca.relativePath(position.Filename),
+						Line:   position.Line,
+					})
+					return true
+				})
+			}
+		}
+	}
+
+	return edges
+}
+
+// relativePath returns a file path relative to the directory the packages were loaded from
+func (ca *CallGraphAnalyzer) relativePath(path string) string {
+	if ca.rootDir == "" {
+		return path
+	}
+	rel, err := filepath.Rel(ca.rootDir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// funcObjectName returns the registered name of a function object, matching the
+// names produced by registerFunctions
+func funcObjectName(fn *types.Func) string {
+	fn = fn.Origin()
+	if fn.Pkg() == nil {
+		return ""
+	}
+
+	name := fn.Name()
+	if sig, ok := fn.Type().(*types.Signature); ok && sig.Recv() != nil {
+		t := sig.Recv().Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+		named, ok := t.(*types.Named)
+		if !ok {
+			return ""
+		}
+		name = named.Obj().Name() + "." + name
+	}
+
+	return fn.Pkg().Path() + "." + name
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CallGraphDiff describes how the call structure changed between two snapshots of a package
+type CallGraphDiff struct {
+	BaseRef          string      `json:"baseRef"`
+	HeadRef          string      `json:"headRef"`
+	AddedFunctions   []string    `json:"addedFunctions"`
+	RemovedFunctions []string    `json:"removedFunctions"`
+	AddedEdges       []CallEdge  `json:"addedEdges"`
+	RemovedEdges     []CallEdge  `json:"removedEdges"`
+	ChangedFunctions []FanChange `json:"changedFunctions"`
+}
+
+// FanChange represents a function whose number of callers or callees changed
+type FanChange struct {
+	Function     string `json:"function"`
+	FanInBefore  int    `json:"fanInBefore"`
+	FanInAfter   int    `json:"fanInAfter"`
+	FanOutBefore int    `json:"fanOutBefore"`
+	FanOutAfter  int    `json:"fanOutAfter"`
+}
+
+// callGraphSnapshot holds the deduplicated call structure of one analyzer
+type callGraphSnapshot struct {
+	functions map[string]bool
+	edges     map[string]CallEdge
+	fanIn     map[string]int
+	fanOut    map[string]int
+}
+
+// newCallGraphSnapshot collapses the call sites of an analyzer into caller/callee pairs
+func newCallGraphSnapshot(ca *CallGraphAnalyzer) callGraphSnapshot {
+	snapshot := callGraphSnapshot{
+		functions: make(map[string]bool),
+		edges:     make(map[string]CallEdge),
+		fanIn:     make(map[string]int),
+		fanOut:    make(map[string]int),
+	}
+
+	for _, name := range ca.Functions() {
+		snapshot.functions[name] = true
+	}
+
+	for _, edge := range ca.CallEdges() {
+		key := edge.Caller + "->" + edge.Callee
+		if _, exists := snapshot.edges[key]; exists {
+			continue
+		}
+		snapshot.edges[key] = edge
+		snapshot.fanOut[edge.Caller]++
+		snapshot.fanIn[edge.Callee]++
+	}
+
+	return snapshot
+}
+
+// DiffCallGraphs compares the call graphs of two analyzers loaded from the same package
+func DiffCallGraphs(base, head *CallGraphAnalyzer) CallGraphDiff {
+	before := newCallGraphSnapshot(base)
+	after := newCallGraphSnapshot(head)
+
+	diff := CallGraphDiff{
+		AddedFunctions:   []string{},
+		RemovedFunctions: []string{},
+		AddedEdges:       []CallEdge{},
+		RemovedEdges:     []CallEdge{},
+		ChangedFunctions: []FanChange{},
+	}
+
+	for name := range after.functions {
+		if !before.functions[name] {
+			diff.AddedFunctions = append(diff.AddedFunctions, name)
+		} else if before.fanIn[name] != after.fanIn[name] || before.fanOut[name] != after.fanOut[name] {
+			diff.ChangedFunctions = append(diff.ChangedFunctions, FanChange{
+				Function:     name,
+				FanInBefore:  before.fanIn[name],
+				FanInAfter:   after.fanIn[name],
+				FanOutBefore: before.fanOut[name],
+				FanOutAfter:  after.fanOut[name],
+			})
+		}
+	}
+	for name := range before.functions {
+		if !after.functions[name] {
+			diff.RemovedFunctions = append(diff.RemovedFunctions, name)
+		}
+	}
+
+	for key, edge := range after.edges {
+		if _, exists := before.edges[key]; !exists {
+			diff.AddedEdges = append(diff.AddedEdges, edge)
+		}
+	}
+	for key, edge := range before.edges {
+		if _, exists := after.edges[key]; !exists {
+			diff.RemovedEdges = append(diff.RemovedEdges, edge)
+		}
+	}
+
+	sort.Strings(diff.AddedFunctions)
+	sort.Strings(diff.RemovedFunctions)
+	sortCallEdges(diff.AddedEdges)
+	sortCallEdges(diff.RemovedEdges)
+	sort.Slice(diff.ChangedFunctions, func(i, j int) bool {
+		return diff.ChangedFunctions[i].Function < diff.ChangedFunctions[j].Function
+	})
+
+	return diff
+}
+
+// sortCallEdges orders edges by caller and then callee
+func sortCallEdges(edges []CallEdge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Caller != edges[j].Caller {
+			return edges[i].Caller < edges[j].Caller
+		}
+		return edges[i].Callee < edges[j].Callee
+	})
+}
+
+// diffNodeStatus classifies every function that appears in the rendered diff
+func (d CallGraphDiff) diffNodeStatus() (map[string]string, []string) {
+	status := make(map[string]string)
+	for _, edge := range d.AddedEdges {
+		status[edge.Caller] = "unchanged"
+		status[edge.Callee] = "unchanged"
+	}
+	for _, edge := range d.RemovedEdges {
+		status[edge.Caller] = "unchanged"
+		status[edge.Callee] = "unchanged"
+	}
+	for _, change := range d.ChangedFunctions {
+		status[change.Function] = "changed"
+	}
+	for _, name := range d.AddedFunctions {
+		status[name] = "added"
+	}
+	for _, name := range d.RemovedFunctions {
+		status[name] = "removed"
+	}
+
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return status, names
+}
+
+// diffColors maps a diff status to the color used when rendering it
+var diffColors = map[string]string{
+	"added":     "#2da44e",
+	"removed":   "#cf222e",
+	"changed":   "#bf8700",
+	"unchanged": "#8c959f",
+}
+
+// DOT renders the diff as a Graphviz digraph with added elements in green,
+// removed elements in red and functions with a changed fan-in/fan-out in amber
+func (d CallGraphDiff) DOT() string {
+	status, names := d.diffNodeStatus()
+
+	var sb strings.Builder
+	sb.WriteString("digraph callgraphdiff {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, style=filled, fontcolor=white];\n")
+
+	for _, name := range names {
+		fmt.Fprintf(&sb, "  %q [fillcolor=%q];\n", name, diffColors[status[name]])
+	}
+	for _, edge := range d.AddedEdges {
+		fmt.Fprintf(&sb, "  %q -> %q [color=%q];\n", edge.Caller, edge.Callee, diffColors["added"])
+	}
+	for _, edge := range d.RemovedEdges {
+		fmt.Fprintf(&sb, "  %q -> %q [color=%q, style=dashed];\n", edge.Caller, edge.Callee, diffColors["removed"])
+	}
+
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// Mermaid renders the diff as a Mermaid flowchart using the same colors as DOT
+func (d CallGraphDiff) Mermaid() string {
+	status, names := d.diffNodeStatus()
+	ids := make(map[string]string, len(names))
+
+	var sb strings.Builder
+	sb.WriteString("graph LR\n")
+
+	for i, name := range names {
+		ids[name] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&sb, "  %s[\"%s\"]:::%s\n", ids[name], strings.ReplaceAll(name, "\"", "#quot;"), status[name])
+	}
+
+	link := 0
+	for _, edge := range d.AddedEdges {
+		fmt.Fprintf(&sb, "  %s --> %s\n", ids[edge.Caller], ids[edge.Callee])
+		fmt.Fprintf(&sb, "  linkStyle %d stroke:%s\n", link, diffColors["added"])
+		link++
+	}
+	for _, edge := range d.RemovedEdges {
+		fmt.Fprintf(&sb, "  %s -.-> %s\n", ids[edge.Caller], ids[edge.Callee])
+		fmt.Fprintf(&sb, "  linkStyle %d stroke:%s\n", link, diffColors["removed"])
+		link++
+	}
+
+	for _, class := range []string{"added", "removed", "changed", "unchanged"} {
+		fmt.Fprintf(&sb, "  classDef %s fill:%s,color:#fff\n", class, diffColors[class])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitFixture runs git in dir and fails the test on error
+func gitFixture(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commitFixture writes a file in the work tree and pushes it as a new commit
+func commitFixture(t *testing.T, work, file, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(work, file)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, file), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gitFixture(t, work, "add", "-A")
+	gitFixture(t, work, "commit", "-q", "-m", "change "+file)
+	gitFixture(t, work, "push", "-q", "origin", "HEAD")
+	return gitFixture(t, work, "rev-parse", "HEAD")
+}
+
+// bareRepoFixture creates a bare repository with a main and a feature branch, and a
+// work tree pushing to it
+func bareRepoFixture(t *testing.T) (string, string) {
+	t.Helper()
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+
+	root := t.TempDir()
+	bare := filepath.Join(root, "origin.git")
+	work := filepath.Join(root, "work")
+	gitFixture(t, root, "init", "-q", "--bare", "-b", "main", bare)
+	gitFixture(t, root, "clone", "-q", bare, work)
+
+	commitFixture(t, work, "api/api.go", "package api\n")
+	commitFixture(t, work, "docs/readme.md", "docs\n")
+	gitFixture(t, work, "checkout", "-q", "-b", "feature")
+	commitFixture(t, work, "api/feature.go", "package api\n")
+	gitFixture(t, work, "checkout", "-q", "main")
+	return bare, work
+}
+
+func TestCloneRepoOptions(t *testing.T) {
+	bare, _ := bareRepoFixture(t)
+	dir := filepath.Join(t.TempDir(), "clone")
+
+	options := CloneOptions{Branch: "feature", Depth: 1, SparsePaths: []string{"api"}}
+	if err := CloneRepo("file://"+bare, dir, options); err != nil {
+		t.Fatal(err)
+	}
+
+	if branch := gitFixture(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "feature" {
+		t.Errorf("checked out %s, want feature", branch)
+	}
+	if count := gitFixture(t, dir, "rev-list", "--count", "HEAD"); count != "1" {
+		t.Errorf("shallow clone has %s commits, want 1", count)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "api", "feature.go")); err != nil {
+		t.Errorf("sparse path not checked out: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs")); !os.IsNotExist(err) {
+		t.Errorf("path outside the sparse paths checked out: %v", err)
+	}
+}
+
+func TestCloneRepoTokenRequiresHTTPS(t *testing.T) {
+	bare, _ := bareRepoFixture(t)
+	if err := CloneRepo("file://"+bare, filepath.Join(t.TempDir(), "clone"), CloneOptions{Token: "secret"}); err == nil {
+		t.Error("token accepted for a file remote")
+	}
+
+	remote, err := ParseRemoteURL("http://example.com/org/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cloneEnv(remote, CloneOptions{Token: "secret"}); err == nil {
+		t.Error("token accepted for a plain http remote")
+	}
+}
+
+func TestCloneEnvScopesToken(t *testing.T) {
+	remote, err := ParseRemoteURL("https://github.com/org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := cloneEnv(remote, CloneOptions{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, entry := range env {
+		if entry == "GIT_CONFIG_KEY_0=http.extraHeader" {
+			t.Error("token header applies to every host")
+		}
+		if entry == "GIT_CONFIG_KEY_0=http.https://github.com/.extraHeader" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no token header scoped to the repo host in %v", env)
+	}
+}
+
+func TestUpdateRepo(t *testing.T) {
+	bare, work := bareRepoFixture(t)
+	dir := filepath.Join(t.TempDir(), "clone")
+	if err := CloneRepo(bare, dir, CloneOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	update, err := UpdateRepo(dir, "", CloneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !update.UpToDate {
+		t.Errorf("fresh clone not up to date: %+v", update)
+	}
+
+	head := commitFixture(t, work, "api/next.go", "package api\n")
+	update, err = UpdateRepo(dir, "", CloneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.UpToDate || update.After != head || len(update.Commits) != 1 {
+		t.Errorf("update = %+v, want one commit up to %s", update, head)
+	}
+
+	update, err = UpdateRepo(dir, "feature", CloneOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if branch := gitFixture(t, dir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "feature" {
+		t.Errorf("checked out %s after updating to feature", branch)
+	}
+
+	if _, err := UpdateRepo(dir, "missing", CloneOptions{}); err == nil {
+		t.Error("update to an unknown ref succeeded")
+	}
+}
@@ -0,0 +1,392 @@
+package utils
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/scanner"
+	"go/token"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCloneMinLines is the smallest statement sequence, in lines, reported as a clone
+const DefaultCloneMinLines = 6
+
+// CloneLocation represents one occurrence of a duplicated statement sequence
+type CloneLocation struct {
+	File      string `json:"file"`
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+}
+
+// CloneClass groups statement sequences that are duplicates of each other.
+// Exact clones are token for token identical, renamed clones only differ in identifier names.
+type CloneClass struct {
+	ID         int             `json:"id"`
+	Kind       string          `json:"kind"` // exact or renamed
+	Lines      int             `json:"lines"`
+	Statements int             `json:"statements"`
+	Locations  []CloneLocation `json:"locations"`
+}
+
+// FileDuplication contains the share of a file's lines that are part of a clone
+type FileDuplication struct {
+	Lines           int     `json:"lines"`
+	DuplicatedLines int     `json:"duplicatedLines"`
+	DuplicatePct    float64 `json:"duplicatePercentage"`
+}
+
+// CloneReport contains every clone class found in the loaded packages
+type CloneReport struct {
+	MinLines int                        `json:"minLines"`
+	Classes  []CloneClass               `json:"classes"`
+	Files    map[string]FileDuplication `json:"files"`
+}
+
+// MaxCloneMinLines is the largest minimum clone size that can be asked for
+const MaxCloneMinLines = 100
+
+// cloneBlock is a statement list with the tokens and lines of its statements
+type cloneBlock struct {
+	filename   string
+	tokens     []stmtTokens
+	startLines []int
+	endLines   []int
+}
+
+// cloneWindow is a candidate statement sequence of a block
+type cloneWindow struct {
+	block    *cloneBlock
+	start    int // Index of the first statement
+	end      int // Index of the last statement
+	exactKey uint64
+	hash     *windowHash // Grows along with the window
+}
+
+// stmtTokens holds the tokens of a printed statement, with identifiers marked
+type stmtTokens struct {
+	texts  []string
+	idents []bool
+}
+
+// DetectClones finds exact and renamed-identifier clones of statement sequences
+// spanning at least minLines lines, grouped into clone classes. Matching statements
+// are grown into longer sequences a statement at a time for as long as they keep
+// matching, so only duplicated code is hashed more than once.
+func (ca *CallGraphAnalyzer) DetectClones(minLines int) CloneReport {
+	if minLines <= 0 {
+		minLines = DefaultCloneMinLines
+	}
+	minLines = min(minLines, MaxCloneMinLines)
+
+	report := CloneReport{
+		MinLines: minLines,
+		Classes:  []CloneClass{},
+		Files:    make(map[string]FileDuplication),
+	}
+
+	blocks := []*cloneBlock{}
+	for _, pkgPath := range ca.PackagePaths() {
+		for _, file := range ca.pkgs[pkgPath].Syntax {
+			tokenFile := ca.fset.File(file.Pos())
+			if tokenFile == nil {
+				continue
+			}
+			filename := ca.relativePath(tokenFile.Name())
+			report.Files[filename] = FileDuplication{Lines: tokenFile.LineCount()}
+
+			ast.Inspect(file, func(n ast.Node) bool {
+				var list []ast.Stmt
+				switch n := n.(type) {
+				case *ast.BlockStmt:
+					list = n.List
+				case *ast.CaseClause:
+					list = n.Body
+				case *ast.CommClause:
+					list = n.Body
+				default:
+					return true
+				}
+
+				block := &cloneBlock{filename: filename}
+				for _, stmt := range list {
+					block.tokens = append(block.tokens, ca.tokenizeStmt(stmt))
+					block.startLines = append(block.startLines, ca.fset.Position(stmt.Pos()).Line)
+					block.endLines = append(block.endLines, ca.fset.Position(stmt.End()).Line)
+				}
+				blocks = append(blocks, block)
+				return true
+			})
+		}
+	}
+
+	// Identical statements seed the windows that are grown into clones
+	groups := make(map[uint64][]cloneWindow)
+	for _, block := range blocks {
+		for start, tokens := range block.tokens {
+			hash := newWindowHash()
+			hash.add(tokens)
+			window := cloneWindow{block: block, start: start, end: start, exactKey: hash.exact, hash: hash}
+			groups[hash.renamed] = append(groups[hash.renamed], window)
+		}
+	}
+
+	var classes []CloneClass
+	for _, windows := range groups {
+		classes = append(classes, growClones(windows, minLines)...)
+	}
+
+	// Report the largest clones first and drop the smaller sequences they contain
+	sort.Slice(classes, func(i, j int) bool {
+		if classes[i].Lines != classes[j].Lines {
+			return classes[i].Lines > classes[j].Lines
+		}
+		first, second := classes[i].Locations[0], classes[j].Locations[0]
+		if first.File != second.File {
+			return first.File < second.File
+		}
+		return first.StartLine < second.StartLine
+	})
+	for _, class := range classes {
+		subsumed := false
+		for _, larger := range report.Classes {
+			if cloneClassContains(larger, class) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			class.ID = len(report.Classes) + 1
+			report.Classes = append(report.Classes, class)
+		}
+	}
+
+	// Compute the duplicated share of every file
+	duplicated := make(map[string]map[int]bool)
+	for _, class := range report.Classes {
+		for _, location := range class.Locations {
+			if duplicated[location.File] == nil {
+				duplicated[location.File] = make(map[int]bool)
+			}
+			for line := location.StartLine; line <= location.EndLine; line++ {
+				duplicated[location.File][line] = true
+			}
+		}
+	}
+	for filename, lines := range duplicated {
+		stats := report.Files[filename]
+		stats.DuplicatedLines = len(lines)
+		if stats.Lines > 0 {
+			stats.DuplicatePct = math.Round(float64(stats.DuplicatedLines) / float64(stats.Lines) * 100)
+		}
+		report.Files[filename] = stats
+	}
+
+	return report
+}
+
+// growClones grows a group of matching windows a statement at a time, splitting it
+// into the windows that still match each other. A clone class of the windows spanning
+// at least minLines lines is returned for every group that cannot grow as a whole.
+func growClones(windows []cloneWindow, minLines int) []CloneClass {
+	classes := []CloneClass{}
+	pending := [][]cloneWindow{nonOverlappingWindows(windows)}
+	for len(pending) > 0 {
+		windows := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if len(windows) < 2 {
+			continue
+		}
+
+		grown := make(map[uint64][]cloneWindow)
+		for _, window := range windows {
+			if window.end+1 < len(window.block.tokens) {
+				window.hash.add(window.block.tokens[window.end+1])
+				window.end++
+				window.exactKey = window.hash.exact
+				grown[window.hash.renamed] = append(grown[window.hash.renamed], window)
+			}
+		}
+
+		whole := false
+		for key, group := range grown {
+			group = nonOverlappingWindows(group)
+			grown[key] = group
+			whole = whole || len(group) == len(windows)
+		}
+		if !whole {
+			large := []cloneWindow{}
+			for _, window := range windows {
+				if location := window.location(); location.EndLine-location.StartLine+1 >= minLines {
+					large = append(large, window)
+				}
+			}
+			if len(large) >= 2 {
+				classes = append(classes, newCloneClass(large))
+			}
+		}
+		for _, group := range grown {
+			pending = append(pending, group)
+		}
+	}
+	return classes
+}
+
+// newCloneClass describes a group of matching windows
+func newCloneClass(windows []cloneWindow) CloneClass {
+	class := CloneClass{
+		Kind:       "exact",
+		Statements: windows[0].end - windows[0].start + 1,
+	}
+	for _, window := range windows {
+		if window.exactKey != windows[0].exactKey {
+			class.Kind = "renamed"
+		}
+		location := window.location()
+		class.Locations = append(class.Locations, location)
+		class.Lines = max(class.Lines, location.EndLine-location.StartLine+1)
+	}
+	return class
+}
+
+// location returns where a window is in its file
+func (w cloneWindow) location() CloneLocation {
+	return CloneLocation{
+		File:      w.block.filename,
+		StartLine: w.block.startLines[w.start],
+		EndLine:   w.block.endLines[w.end],
+	}
+}
+
+// tokenizeStmt prints a statement and splits it into tokens, ignoring comments and layout
+func (ca *CallGraphAnalyzer) tokenizeStmt(stmt ast.Stmt) stmtTokens {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, ca.fset, stmt); err != nil {
+		return stmtTokens{}
+	}
+	src := buf.Bytes()
+
+	fset := token.NewFileSet()
+	var s scanner.Scanner
+	s.Init(fset.AddFile("", fset.Base(), len(src)), src, nil, 0)
+
+	var tokens stmtTokens
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		text := tok.String()
+		if lit != "" {
+			text = lit
+		}
+		tokens.texts = append(tokens.texts, text)
+		tokens.idents = append(tokens.idents, tok == token.IDENT)
+	}
+	return tokens
+}
+
+// FNV-1a parameters of windowHash
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// windowHash hashes a statement sequence twice, growing with it: once verbatim, and
+// once with identifiers consistently renamed in order of first appearance
+type windowHash struct {
+	exact   uint64
+	renamed uint64
+	names   map[string]int
+}
+
+// newWindowHash creates the hashes of an empty sequence
+func newWindowHash() *windowHash {
+	return &windowHash{
+		exact:   fnvOffset64,
+		renamed: fnvOffset64,
+		names:   make(map[string]int),
+	}
+}
+
+// add appends a statement to the hashed sequence
+func (h *windowHash) add(stmt stmtTokens) {
+	for i, text := range stmt.texts {
+		h.exact = fnvAdd(h.exact, text, 0)
+
+		if stmt.idents[i] {
+			index, ok := h.names[text]
+			if !ok {
+				index = len(h.names)
+				h.names[text] = index
+			}
+			text = "$" + strconv.Itoa(index)
+		}
+		h.renamed = fnvAdd(h.renamed, text, 0)
+	}
+	h.exact = fnvAdd(h.exact, "", 1)
+	h.renamed = fnvAdd(h.renamed, "", 1)
+}
+
+// fnvAdd feeds a text followed by a separator byte into an FNV-1a hash
+func fnvAdd(hash uint64, text string, separator byte) uint64 {
+	for i := 0; i < len(text); i++ {
+		hash ^= uint64(text[i])
+		hash *= fnvPrime64
+	}
+	hash ^= uint64(separator)
+	hash *= fnvPrime64
+	return hash
+}
+
+// nonOverlappingWindows drops windows overlapping an earlier window of the same file,
+// which happens for sequences of repeated statements
+func nonOverlappingWindows(windows []cloneWindow) []cloneWindow {
+	sort.Slice(windows, func(i, j int) bool {
+		first, second := windows[i].location(), windows[j].location()
+		if first.File != second.File {
+			return first.File < second.File
+		}
+		return first.StartLine < second.StartLine
+	})
+
+	kept := windows[:0]
+	for _, window := range windows {
+		if n := len(kept); n > 0 && kept[n-1].location().File == window.location().File &&
+			kept[n-1].location().EndLine >= window.location().StartLine {
+			continue
+		}
+		kept = append(kept, window)
+	}
+	return kept
+}
+
+// cloneClassContains reports whether every location of inner lies within a location of outer
+func cloneClassContains(outer, inner CloneClass) bool {
+	for _, location := range inner.Locations {
+		contained := false
+		for _, candidate := range outer.Locations {
+			if candidate.File == location.File && candidate.StartLine <= location.StartLine &&
+				location.EndLine <= candidate.EndLine {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// DuplicatePercentage returns the duplicated share of a file given its path
+// relative to the loaded directory
+func (r CloneReport) DuplicatePercentage(relPath string) float64 {
+	return r.Files[strings.TrimPrefix(relPath, "/")].DuplicatePct
+}
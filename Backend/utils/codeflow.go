@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -25,6 +26,7 @@ type FunctionNode struct {
 	Children   []*FunctionNode
 	IsExternal bool // Whether this function is from an external package we couldn't analyze
 	IsAnalysed bool
+	Ownership  *FunctionOwnership // Who last changed the function's lines, set on request
 }
 
 // NewFunctionNode creates a new function node
@@ -63,7 +65,10 @@ type CallGraphAnalyzer struct {
 	pkgs          map[string]*packages.Package
 	functionNodes map[string]*FunctionNode
 	moduleName    string
+	rootDir       string
 	pathToPackage map[string]string
+	loadErrors    []string
+	retired       []*token.File // Files of the packages replaced by ReloadPackages
 }
 
 // NewCallGraphAnalyzer creates a new analyzer with the packages.Load config
@@ -79,7 +84,39 @@ func NewCallGraphAnalyzer(moduleName string) *CallGraphAnalyzer {
 
 // LoadPackages loads packages using the x/tools/go/packages API
 func (ca *CallGraphAnalyzer) LoadPackages(modulePath string, patterns ...string) error {
-	config := &packages.Config{
+	return ca.LoadPackagesContext(context.Background(), modulePath, nil, patterns...)
+}
+
+// LoadPackagesContext loads packages like LoadPackages and reports how many of them were
+// registered to progress if it is set. Loading stops when ctx is canceled.
+func (ca *CallGraphAnalyzer) LoadPackagesContext(ctx context.Context, modulePath string, progress func(loaded, total int), patterns ...string) error {
+	pkgs, err := packages.Load(ca.loadConfig(ctx, modulePath), patterns...)
+	if err != nil {
+		return fmt.Errorf("error loading packages: %v", err)
+	}
+	ca.loadErrors = append(ca.loadErrors, collectLoadErrors(pkgs)...)
+
+	ca.rootDir = modulePath
+
+	// Register all functions from loaded packages
+	for i, pkg := range pkgs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ca.pathToPackage[pkg.Dir] = pkg.PkgPath
+		ca.pkgs[pkg.PkgPath] = pkg
+		ca.registerFunctions(pkg)
+		if progress != nil {
+			progress(i+1, len(pkgs))
+		}
+	}
+
+	return nil
+}
+
+// loadConfig returns the packages.Load config for packages of the module at modulePath
+func (ca *CallGraphAnalyzer) loadConfig(ctx context.Context, modulePath string) *packages.Config {
+	return &packages.Config{
 		Mode: packages.NeedName |
 			packages.NeedFiles |
 			packages.NeedSyntax |
@@ -87,31 +124,68 @@ func (ca *CallGraphAnalyzer) LoadPackages(modulePath string, patterns ...string)
 			packages.NeedTypesInfo |
 			packages.NeedImports |
 			packages.NeedDeps,
-		Fset: ca.fset,
-		Dir:  modulePath,
-		Env:  append(os.Environ(), "GO111MODULE=on"),
+		Context: ctx,
+		Fset:    ca.fset,
+		Dir:     modulePath,
+		Env:     append(os.Environ(), "GO111MODULE=on"),
 		// ParseFile can be customized if needed to handle build tags, etc.
 	}
+}
 
-	var err error
-	pkgs, err := packages.Load(config, patterns...)
-	if err != nil {
-		return fmt.Errorf("error loading packages: %v", err)
-	}
-
+// collectLoadErrors returns the errors of the loaded packages and their dependencies
+func collectLoadErrors(pkgs []*packages.Package) []string {
+	loadErrors := []string{}
 	if packages.PrintErrors(pkgs) > 0 {
 		// Continue with what we have, but warn the user
 		fmt.Println("Warning: Some packages had errors, analysis may be incomplete")
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			for _, pkgErr := range pkg.Errors {
+				loadErrors = append(loadErrors, pkgErr.Error())
+			}
+		})
 	}
+	return loadErrors
+}
 
-	// Register all functions from loaded packages
-	for _, pkg := range pkgs {
-		ca.pathToPackage[pkg.Dir] = pkg.PkgPath
-		ca.pkgs[pkg.PkgPath] = pkg
-		ca.registerFunctions(pkg)
+// LoadErrors returns the errors reported while loading the packages
+func (ca *CallGraphAnalyzer) LoadErrors() []string {
+	return append([]string{}, ca.loadErrors...)
+}
+
+// Approximate sizes used by EstimatedMemory
+const (
+	astNodeBytes   = 64 // A syntax tree node with its positions and links
+	typeEntryBytes = 48 // An entry of a types.Info map
+)
+
+// EstimatedMemory approximates the memory held by the loaded packages and their
+// dependencies from the size of their sources, syntax trees and type information
+func (ca *CallGraphAnalyzer) EstimatedMemory() uint64 {
+	roots := make([]*packages.Package, 0, len(ca.pkgs))
+	for _, pkg := range ca.pkgs {
+		roots = append(roots, pkg)
 	}
 
-	return nil
+	var size uint64
+	packages.Visit(roots, nil, func(pkg *packages.Package) {
+		for _, file := range pkg.Syntax {
+			if tokenFile := ca.fset.File(file.Pos()); tokenFile != nil {
+				size += uint64(tokenFile.Size())
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				if n != nil {
+					size += astNodeBytes
+				}
+				return true
+			})
+		}
+		if info := pkg.TypesInfo; info != nil {
+			entries := len(info.Types) + len(info.Defs) + len(info.Uses) + len(info.Implicits) +
+				len(info.Selections) + len(info.Scopes) + len(info.Instances)
+			size += uint64(entries) * typeEntryBytes
+		}
+	})
+	return size
 }
 
 // registerFunctions finds and registers all functions in the loaded packages
@@ -122,45 +196,7 @@ func (ca *CallGraphAnalyzer) registerFunctions(pkg *packages.Package) {
 		ast.Inspect(file, func(n ast.Node) bool {
 			if funcDecl, ok := n.(*ast.FuncDecl); ok {
 				position := ca.fset.Position(funcDecl.Pos())
-				funcName := funcDecl.Name.Name
-
-				// Handle methods
-				if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
-					var recvType string
-					recvExpr := funcDecl.Recv.List[0].Type
-
-					// Try to get the receiver type using type info
-					tv, ok := pkg.TypesInfo.Types[recvExpr]
-					if ok {
-						// Remove pointer if present
-						t := tv.Type
-						if ptr, ok := t.(*types.Pointer); ok {
-							t = ptr.Elem()
-						}
-
-						// Get type name
-						if named, ok := t.(*types.Named); ok {
-							recvType = named.Obj().Name()
-						} else {
-							// Fallback to string representation
-							recvType = t.String()
-						}
-					} else {
-						// Fallback for when type info is not available
-						switch t := recvExpr.(type) {
-						case *ast.StarExpr:
-							if ident, ok := t.X.(*ast.Ident); ok {
-								recvType = ident.Name
-							}
-						case *ast.Ident:
-							recvType = t.Name
-						}
-					}
-
-					if recvType != "" {
-						funcName = recvType + "." + funcName
-					}
-				}
+				funcName := declaredFuncName(pkg, funcDecl)
 
 				doc := ""
 				if funcDecl.Doc != nil {
@@ -176,6 +212,52 @@ func (ca *CallGraphAnalyzer) registerFunctions(pkg *packages.Package) {
 	}
 }
 
+// declaredFuncName returns the name a function declaration is registered under,
+// prefixed with its receiver type for methods
+func declaredFuncName(pkg *packages.Package, funcDecl *ast.FuncDecl) string {
+	funcName := funcDecl.Name.Name
+
+	// Handle methods
+	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+		var recvType string
+		recvExpr := funcDecl.Recv.List[0].Type
+
+		// Try to get the receiver type using type info
+		tv, ok := pkg.TypesInfo.Types[recvExpr]
+		if ok {
+			// Remove pointer if present
+			t := tv.Type
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+
+			// Get type name
+			if named, ok := t.(*types.Named); ok {
+				recvType = named.Obj().Name()
+			} else {
+				// Fallback to string representation
+				recvType = t.String()
+			}
+		} else {
+			// Fallback for when type info is not available
+			switch t := recvExpr.(type) {
+			case *ast.StarExpr:
+				if ident, ok := t.X.(*ast.Ident); ok {
+					recvType = ident.Name
+				}
+			case *ast.Ident:
+				recvType = t.Name
+			}
+		}
+
+		if recvType != "" {
+			funcName = recvType + "." + funcName
+		}
+	}
+
+	return funcName
+}
+
 // BuildFunctionCallTree builds a call tree starting from the specified function
 func (ca *CallGraphAnalyzer) BuildFunctionCallTree(pkgPath, funcName string, visited map[string]bool) (*FunctionNode, error) {
 	pkgName, ok := ca.pathToPackage[pkgPath]
@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DiffLine is a line of a diff hunk. OldLine is 0 for added lines and NewLine is 0
+// for deleted lines.
+type DiffLine struct {
+	Kind    string `json:"kind"` // context, added or deleted
+	OldLine int    `json:"oldLine,omitempty"`
+	NewLine int    `json:"newLine,omitempty"`
+	Content string `json:"content"`
+}
+
+// DiffHunk is a contiguous block of changes in a file
+type DiffHunk struct {
+	Header    string     `json:"header"`
+	OldStart  int        `json:"oldStart"`
+	OldLines  int        `json:"oldLines"`
+	NewStart  int        `json:"newStart"`
+	NewLines  int        `json:"newLines"`
+	Functions []string   `json:"functions"`
+	Lines     []DiffLine `json:"lines"`
+}
+
+// FileDiff contains the changes a commit made to a single file
+type FileDiff struct {
+	Path       string     `json:"path"`
+	OldPath    string     `json:"oldPath,omitempty"`
+	Status     string     `json:"status"`
+	Renamed    bool       `json:"renamed,omitempty"`
+	Similarity int        `json:"similarity,omitempty"`
+	Binary     bool       `json:"binary,omitempty"`
+	Additions  int        `json:"additions"`
+	Deletions  int        `json:"deletions"`
+	Hunks      []DiffHunk `json:"hunks"`
+}
+
+// CommitDetail contains a commit's metadata, its parsed diff against its first parent
+// and the functions the diff modifies
+type CommitDetail struct {
+	GitCommit
+	Body              string     `json:"body"`
+	Parents           []string   `json:"parents"`
+	Files             []FileDiff `json:"files"`
+	ModifiedFunctions []string   `json:"modifiedFunctions"`
+}
+
+var diffHunkRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// GetCommitDetail returns the metadata and parsed diff of a commit. File paths are
+// relative to repoPath and only changes below it are included.
+func GetCommitDetail(repoPath, commit string) (CommitDetail, error) {
+	output, err := execGitCommand(repoPath, "-c", "core.quotepath=off", "show", commit,
+		"-M", "--no-color", "--relative", "--diff-merges=first-parent",
+		"--format=%x00%H%x00%P%x00%an%x00%ae%x00%aI%x00%B%x00", "--", ".")
+	if err != nil {
+		return CommitDetail{}, fmt.Errorf("failed to get git commit: %w", err)
+	}
+
+	fields := strings.SplitN(strings.TrimPrefix(output, "\x00"), "\x00", 7)
+	if len(fields) != 7 {
+		return CommitDetail{}, fmt.Errorf("unexpected git show output for %s", commit)
+	}
+
+	message := strings.TrimSpace(fields[5])
+	subject, body, _ := strings.Cut(message, "\n")
+	return CommitDetail{
+		GitCommit: GitCommit{
+			Hash:    fields[0],
+			Author:  fields[2],
+			Email:   fields[3],
+			Date:    fields[4],
+			Message: subject,
+		},
+		Body:              strings.TrimSpace(body),
+		Parents:           strings.Fields(fields[1]),
+		Files:             parseUnifiedDiff(fields[6]),
+		ModifiedFunctions: []string{},
+	}, nil
+}
+
+// parseUnifiedDiff parses the output of git diff into files, hunks and lines
+func parseUnifiedDiff(diff string) []FileDiff {
+	files := []FileDiff{}
+	var file *FileDiff
+	var hunk *DiffHunk
+	oldLine, newLine := 0, 0
+
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			// The header paths are only a fallback for renames and binary files
+			// without --- and +++ lines
+			oldPath, newPath, _ := strings.Cut(strings.TrimPrefix(line, "diff --git a/"), " b/")
+			files = append(files, FileDiff{
+				Path:    newPath,
+				OldPath: oldPath,
+				Status:  translateGitStatus("M"),
+				Hunks:   []DiffHunk{},
+			})
+			file = &files[len(files)-1]
+			hunk = nil
+			continue
+		}
+		if file == nil {
+			continue
+		}
+
+		if hunk == nil {
+			switch {
+			case strings.HasPrefix(line, "new file mode"):
+				file.Status = translateGitStatus("A")
+			case strings.HasPrefix(line, "deleted file mode"):
+				file.Status = translateGitStatus("D")
+			case strings.HasPrefix(line, "similarity index "):
+				file.Similarity, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "similarity index "), "%"))
+			case strings.HasPrefix(line, "rename from "):
+				file.OldPath = strings.TrimPrefix(line, "rename from ")
+				file.Renamed = true
+				file.Status = translateGitStatus("R")
+			case strings.HasPrefix(line, "rename to "):
+				file.Path = strings.TrimPrefix(line, "rename to ")
+			case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+				file.Binary = true
+			case strings.HasPrefix(line, "--- "):
+				if name := strings.TrimPrefix(line, "--- "); name != "/dev/null" {
+					file.OldPath = strings.TrimPrefix(name, "a/")
+				}
+			case strings.HasPrefix(line, "+++ "):
+				if name := strings.TrimPrefix(line, "+++ "); name != "/dev/null" {
+					file.Path = strings.TrimPrefix(name, "b/")
+				}
+			}
+		}
+
+		if matches := diffHunkRegex.FindStringSubmatch(line); matches != nil {
+			file.Hunks = append(file.Hunks, DiffHunk{
+				Header:    line,
+				OldStart:  atoiDefault(matches[1], 0),
+				OldLines:  atoiDefault(matches[2], 1),
+				NewStart:  atoiDefault(matches[3], 0),
+				NewLines:  atoiDefault(matches[4], 1),
+				Functions: []string{},
+				Lines:     []DiffLine{},
+			})
+			hunk = &file.Hunks[len(file.Hunks)-1]
+			oldLine, newLine = hunk.OldStart, hunk.NewStart
+			continue
+		}
+		if hunk == nil || line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case ' ':
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: "context", OldLine: oldLine, NewLine: newLine, Content: line[1:]})
+			oldLine++
+			newLine++
+		case '+':
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: "added", NewLine: newLine, Content: line[1:]})
+			file.Additions++
+			newLine++
+		case '-':
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: "deleted", OldLine: oldLine, Content: line[1:]})
+			file.Deletions++
+			oldLine++
+		}
+	}
+
+	// Unchanged paths of modified files are only reported once
+	for i := range files {
+		if !files[i].Renamed && files[i].OldPath == files[i].Path {
+			files[i].OldPath = ""
+		}
+	}
+
+	return files
+}
+
+// atoiDefault parses s, returning def when s is empty
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+	value, _ := strconv.Atoi(s)
+	return value
+}
+
+// AnnotateFunctions sets the functions each hunk of a Go file touches. Added lines are
+// matched against the declarations in the commit, deleted lines against those in its
+// first parent. Names are qualified with the package path the file's directory has in
+// the analyzer, so they match the call graph.
+func (ca *CallGraphAnalyzer) AnnotateFunctions(repoPath string, detail *CommitDetail) {
+	packageDirs := make(map[string]string)
+	for pkgPath, pkg := range ca.pkgs {
+		for _, goFile := range pkg.GoFiles {
+			packageDirs[path.Dir(ca.relativePath(goFile))] = pkgPath
+		}
+	}
+
+	modified := make(map[string]bool)
+	for i := range detail.Files {
+		file := &detail.Files[i]
+		if file.Binary || !strings.HasSuffix(file.Path, ".go") {
+			continue
+		}
+
+		newSpans := funcDeclSpansAt(repoPath, detail.Hash, file.Path)
+		oldSpans := []FunctionSpan{}
+		if len(detail.Parents) > 0 {
+			oldPath := file.Path
+			if file.OldPath != "" {
+				oldPath = file.OldPath
+			}
+			oldSpans = funcDeclSpansAt(repoPath, detail.Parents[0], oldPath)
+		}
+
+		for j := range file.Hunks {
+			hunk := &file.Hunks[j]
+			touched := make(map[string]bool)
+			for _, line := range hunk.Lines {
+				var name string
+				switch line.Kind {
+				case "added":
+					name = spanAtLine(newSpans, line.NewLine)
+				case "deleted":
+					name = spanAtLine(oldSpans, line.OldLine)
+				}
+				if name == "" {
+					continue
+				}
+				if pkgPath, ok := packageDirs[path.Dir(file.Path)]; ok {
+					name = pkgPath + "." + name
+				}
+				touched[name] = true
+				modified[name] = true
+			}
+			hunk.Functions = sortedKeys(touched)
+		}
+	}
+
+	detail.ModifiedFunctions = sortedKeys(modified)
+}
+
+// funcDeclSpansAt parses a Go file as it was at a commit and returns its function
+// declarations. Files that are missing or do not parse have none.
+func funcDeclSpansAt(repoPath, commit, filePath string) []FunctionSpan {
+	// A "./" prefix makes git resolve the path relative to repoPath
+	src, err := execGitCommand(repoPath, "show", commit+":./"+filePath)
+	if err != nil {
+		return nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+
+	spans := []FunctionSpan{}
+	for _, decl := range file.Decls {
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := funcDecl.Name.Name
+		if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+			if recvType := receiverTypeName(funcDecl.Recv.List[0].Type); recvType != "" {
+				name = recvType + "." + name
+			}
+		}
+		// Doc comments belong to the function they describe
+		start := funcDecl.Pos()
+		if funcDecl.Doc != nil {
+			start = funcDecl.Doc.Pos()
+		}
+		spans = append(spans, FunctionSpan{
+			Name:      name,
+			File:      filePath,
+			StartLine: fset.Position(start).Line,
+			EndLine:   fset.Position(funcDecl.End()).Line,
+		})
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].StartLine < spans[j].StartLine
+	})
+	return spans
+}
+
+// receiverTypeName returns the name of a method receiver's type from its syntax
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+// spanAtLine returns the name of the function whose span contains line
+func spanAtLine(spans []FunctionSpan, line int) string {
+	for _, span := range spans {
+		if line >= span.StartLine && line <= span.EndLine {
+			return span.Name
+		}
+	}
+	return ""
+}
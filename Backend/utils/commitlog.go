@@ -0,0 +1,215 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Values of CommitFilter.Merges
+const (
+	MergesOnly    = "only"
+	MergesExclude = "exclude"
+)
+
+// CommitFilter restricts the commits returned by GetCommitLog. Empty fields match everything.
+type CommitFilter struct {
+	Author string // Case-insensitive pattern matched against the author
+	Path   string // File or directory the commits must touch
+	Since  string // Earliest commit date, anything git log --since accepts
+	Until  string // Latest commit date, anything git log --until accepts
+	Grep   string // Case-insensitive pattern matched against the message
+	Merges string // MergesOnly, MergesExclude or empty for both
+}
+
+// CommitFile represents a file changed by a commit
+type CommitFile struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"oldPath,omitempty"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary,omitempty"`
+}
+
+// CommitEntry represents a commit with its ancestry, refs and change statistics.
+// Merge commits are compared against their first parent.
+type CommitEntry struct {
+	GitCommit
+	Parents      []string     `json:"parents"`
+	Refs         []string     `json:"refs"`
+	FilesChanged int          `json:"filesChanged"`
+	Insertions   int          `json:"insertions"`
+	Deletions    int          `json:"deletions"`
+	Files        []CommitFile `json:"files"`
+}
+
+// CommitPage is one page of the commit log. NextCursor is empty on the last page.
+type CommitPage struct {
+	Head       string        `json:"head"`
+	Commits    []CommitEntry `json:"commits"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// commitHash matches a full SHA-1 or SHA-256 commit hash
+var commitHash = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// EncodeCommitCursor builds an opaque cursor pointing offset commits below head.
+// Anchoring the cursor to a commit keeps pages stable while new commits arrive.
+func EncodeCommitCursor(head string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(head + ":" + strconv.Itoa(offset)))
+}
+
+// DecodeCommitCursor parses a cursor created by EncodeCommitCursor. Cursors come from
+// clients, so anything but a full commit hash is rejected as the head.
+func DecodeCommitCursor(cursor string) (string, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, errors.New("invalid cursor")
+	}
+	head, offsetStr, ok := strings.Cut(string(data), ":")
+	offset, err := strconv.Atoi(offsetStr)
+	if !ok || err != nil || offset < 0 || !commitHash.MatchString(head) {
+		return "", 0, errors.New("invalid cursor")
+	}
+	return head, offset, nil
+}
+
+// commitLogFormat is the git log format parsed by parseCommitLog
+const commitLogFormat = "--format=%x00%H%x00%P%x00%D%x00%an%x00%ae%x00%aI%x00%s"
+
+// GetCommitLog lists up to limit commits reachable from head, skipping the first offset,
+// that match the filter. File paths are relative to repoPath.
+func GetCommitLog(repoPath, head string, offset, limit int, filter CommitFilter) (CommitPage, error) {
+	if filter.Merges != "" && filter.Merges != MergesOnly && filter.Merges != MergesExclude {
+		return CommitPage{}, fmt.Errorf("invalid merges filter: %s", filter.Merges)
+	}
+
+	// One extra commit tells whether another page follows
+	args := []string{"log", "-M", "--raw", "--numstat", "--relative", "--no-color",
+		"--diff-merges=first-parent", "--regexp-ignore-case",
+		commitLogFormat, "--skip=" + strconv.Itoa(offset), "-n", strconv.Itoa(limit + 1)}
+	if filter.Author != "" {
+		args = append(args, "--author="+filter.Author)
+	}
+	if filter.Since != "" {
+		args = append(args, "--since="+filter.Since)
+	}
+	if filter.Until != "" {
+		args = append(args, "--until="+filter.Until)
+	}
+	if filter.Grep != "" {
+		args = append(args, "--grep="+filter.Grep)
+	}
+	switch filter.Merges {
+	case MergesOnly:
+		args = append(args, "--merges")
+	case MergesExclude:
+		args = append(args, "--no-merges")
+	}
+	path := filter.Path
+	if path == "" {
+		path = "."
+	}
+	args = append(args, "--end-of-options", head, "--", path)
+
+	logOutput, err := execGitCommand(repoPath, args...)
+	if err != nil {
+		return CommitPage{}, fmt.Errorf("failed to get git log: %w", err)
+	}
+
+	page := CommitPage{
+		Head:    head,
+		Commits: parseCommitLog(logOutput),
+	}
+	if len(page.Commits) > limit {
+		page.Commits = page.Commits[:limit]
+		page.NextCursor = EncodeCommitCursor(head, offset+limit)
+	}
+
+	return page, nil
+}
+
+// parseCommitLog parses git log output with NUL separated headers followed by
+// --raw and --numstat lines, which list the files in the same order
+func parseCommitLog(logOutput string) []CommitEntry {
+	commits := []CommitEntry{}
+	var current *CommitEntry
+	numstatIndex := 0
+
+	for _, line := range strings.Split(logOutput, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\x00"):
+			fields := strings.SplitN(line[1:], "\x00", 7)
+			if len(fields) != 7 {
+				current = nil
+				continue
+			}
+			commits = append(commits, CommitEntry{
+				GitCommit: GitCommit{
+					Hash:    fields[0],
+					Author:  fields[3],
+					Email:   fields[4],
+					Date:    fields[5],
+					Message: fields[6],
+				},
+				Parents: strings.Fields(fields[1]),
+				Refs:    splitRefs(fields[2]),
+				Files:   []CommitFile{},
+			})
+			current = &commits[len(commits)-1]
+			numstatIndex = 0
+
+		case current == nil || line == "":
+			continue
+
+		case strings.HasPrefix(line, ":"):
+			// :<old mode> <new mode> <old sha> <new sha> <status>\t<path>[\t<new path>]
+			meta, paths, _ := strings.Cut(line, "\t")
+			metaFields := strings.Fields(meta)
+			pathFields := strings.Split(paths, "\t")
+			file := CommitFile{
+				Status: translateGitStatus(metaFields[len(metaFields)-1][:1]),
+				Path:   pathFields[len(pathFields)-1],
+			}
+			if len(pathFields) == 2 {
+				file.OldPath = pathFields[0]
+			}
+			current.Files = append(current.Files, file)
+			current.FilesChanged++
+
+		default:
+			// <additions>\t<deletions>\t<path>, with "-" counts for binary files
+			parts := strings.SplitN(line, "\t", 3)
+			if len(parts) != 3 || numstatIndex >= len(current.Files) {
+				continue
+			}
+			file := &current.Files[numstatIndex]
+			numstatIndex++
+			if parts[0] == "-" && parts[1] == "-" {
+				file.Binary = true
+				continue
+			}
+			file.Additions, _ = strconv.Atoi(parts[0])
+			file.Deletions, _ = strconv.Atoi(parts[1])
+			current.Insertions += file.Additions
+			current.Deletions += file.Deletions
+		}
+	}
+
+	return commits
+}
+
+// splitRefs splits the %D decoration of a commit into its refs
+func splitRefs(decoration string) []string {
+	refs := []string{}
+	for _, ref := range strings.Split(decoration, ", ") {
+		if ref = strings.TrimSpace(ref); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
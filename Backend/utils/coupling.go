@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Default thresholds of the change coupling analysis
+const (
+	DefaultCouplingMinSupport  = 2
+	DefaultCouplingMinStrength = 0.3
+)
+
+// MaxCouplingMinSupport is the largest minimum support that can be asked for
+const MaxCouplingMinSupport = 100
+
+// maxChangeSetSize skips commits touching more files, such as mass renames or
+// reformatting, which couple everything with everything
+const maxChangeSetSize = 50
+
+// CouplingPair describes two files or functions that change in the same commits
+type CouplingPair struct {
+	Kind       string  `json:"kind"` // file or function
+	A          string  `json:"a"`
+	B          string  `json:"b"`
+	Support    int     `json:"support"` // Commits changing both
+	RevisionsA int     `json:"revisionsA"`
+	RevisionsB int     `json:"revisionsB"`
+	Strength   float64 `json:"strength"`   // Support relative to the average revisions, from 0 to 1
+	Dependency string  `json:"dependency"` // package, import, call, none or unknown
+	Hidden     bool    `json:"hidden"`     // Coupled without any static dependency
+}
+
+// CouplingReport contains the temporal coupling of a project's files and functions
+type CouplingReport struct {
+	Since       string         `json:"since,omitempty"`
+	MinSupport  int            `json:"minSupport"`
+	MinStrength float64        `json:"minStrength"`
+	Files       []CouplingPair `json:"files"`
+	Functions   []CouplingPair `json:"functions"`
+}
+
+// GetFileChangeSets lists the files changed by every commit below repoPath, relative
+// to repoPath. Merge commits and commits changing too many files are skipped.
+// Commits changing a single file still count towards its revisions.
+func GetFileChangeSets(repoPath, since string) ([][]string, error) {
+	args := []string{"log", "--name-only", "--no-renames", "--relative", "--format=%x00%H"}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	args = append(args, "--", ".")
+
+	logOutput, err := execGitCommand(repoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git log: %w", err)
+	}
+
+	changeSets := [][]string{}
+	for _, entry := range strings.Split(logOutput, "\x00") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		if len(lines) < 2 {
+			continue
+		}
+
+		files := []string{}
+		for _, file := range lines[1:] {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, file)
+			}
+		}
+		if len(files) <= maxChangeSetSize {
+			changeSets = append(changeSets, files)
+		}
+	}
+
+	return changeSets, nil
+}
+
+// GetCommitsSince lists the hashes of the commits below repoPath made since the given
+// date, anything git log --since accepts
+func GetCommitsSince(repoPath, since string) (map[string]bool, error) {
+	logOutput, err := execGitCommand(repoPath, "log", "--format=%H", "--since="+since, "--", ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git log: %w", err)
+	}
+
+	commits := make(map[string]bool)
+	for _, hash := range strings.Fields(logOutput) {
+		commits[hash] = true
+	}
+	return commits, nil
+}
+
+// FunctionChangeSets groups the functions by the commits that last changed their
+// surviving lines according to blame, keyed by function name. Lines from commits
+// missing in commits are skipped, unless commits is nil.
+//
+// Blame only knows the last commit of every line still in the code, so this finds
+// functions whose current code was written in the same commits. Commits whose lines
+// were all rewritten since, or that only deleted lines, leave no trace, and a function
+// counts once per commit however many of its lines the commit changed.
+func FunctionChangeSets(blameRanges map[string][]BlameLine, commits map[string]bool) [][]string {
+	commitFunctions := make(map[string]map[string]bool)
+	for function, lines := range blameRanges {
+		for _, line := range lines {
+			if commits != nil && !commits[line.Commit] {
+				continue
+			}
+			if commitFunctions[line.Commit] == nil {
+				commitFunctions[line.Commit] = make(map[string]bool)
+			}
+			commitFunctions[line.Commit][function] = true
+		}
+	}
+
+	changeSets := [][]string{}
+	for _, functions := range commitFunctions {
+		if len(functions) <= maxChangeSetSize {
+			changeSets = append(changeSets, sortedKeys(functions))
+		}
+	}
+
+	return changeSets
+}
+
+// CouplingPairs finds the pairs of items changed together in at least minSupport
+// change sets with at least minStrength, strongest first
+func CouplingPairs(kind string, changeSets [][]string, minSupport int, minStrength float64) []CouplingPair {
+	revisions := make(map[string]int)
+	shared := make(map[[2]string]int)
+	for _, changeSet := range changeSets {
+		items := append([]string{}, changeSet...)
+		sort.Strings(items)
+		for i, a := range items {
+			revisions[a]++
+			for _, b := range items[i+1:] {
+				shared[[2]string{a, b}]++
+			}
+		}
+	}
+
+	pairs := []CouplingPair{}
+	for key, support := range shared {
+		if support < minSupport {
+			continue
+		}
+		average := float64(revisions[key[0]]+revisions[key[1]]) / 2
+		strength := roundMetric(float64(support) / average)
+		if strength < minStrength {
+			continue
+		}
+		pairs = append(pairs, CouplingPair{
+			Kind:       kind,
+			A:          key[0],
+			B:          key[1],
+			Support:    support,
+			RevisionsA: revisions[key[0]],
+			RevisionsB: revisions[key[1]],
+			Strength:   strength,
+			Dependency: "unknown",
+		})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Strength != pairs[j].Strength {
+			return pairs[i].Strength > pairs[j].Strength
+		}
+		if pairs[i].Support != pairs[j].Support {
+			return pairs[i].Support > pairs[j].Support
+		}
+		return pairs[i].A+pairs[i].B < pairs[j].A+pairs[j].B
+	})
+
+	return pairs
+}
+
+// ClassifyFileCoupling sets the static dependency between coupled files: the same
+// package, an import between their packages, or none. Files outside the loaded Go
+// packages stay unknown.
+func (ca *CallGraphAnalyzer) ClassifyFileCoupling(pairs []CouplingPair) {
+	filePackages := make(map[string]string)
+	for _, pkgPath := range ca.PackagePaths() {
+		for _, goFile := range ca.pkgs[pkgPath].GoFiles {
+			filePackages[path.Clean(ca.relativePath(goFile))] = pkgPath
+		}
+	}
+
+	imports := make(map[[2]string]bool)
+	for _, edge := range ca.ImportEdges() {
+		imports[[2]string{edge.From, edge.To}] = true
+	}
+
+	for i := range pairs {
+		pkgA, okA := filePackages[pairs[i].A]
+		pkgB, okB := filePackages[pairs[i].B]
+		switch {
+		case !okA || !okB:
+			pairs[i].Dependency = "unknown"
+		case pkgA == pkgB:
+			pairs[i].Dependency = "package"
+		case imports[[2]string{pkgA, pkgB}] || imports[[2]string{pkgB, pkgA}]:
+			pairs[i].Dependency = "import"
+		default:
+			pairs[i].Dependency = "none"
+		}
+		pairs[i].Hidden = pairs[i].Dependency == "none"
+	}
+}
+
+// ClassifyFunctionCoupling sets the static dependency between coupled functions: a
+// call between them, the same package, or none. Like for files, only functions of
+// different packages without a call between them are hidden.
+func (ca *CallGraphAnalyzer) ClassifyFunctionCoupling(pairs []CouplingPair) {
+	calls := make(map[[2]string]bool)
+	for _, edge := range ca.CallEdges() {
+		calls[[2]string{edge.Caller, edge.Callee}] = true
+	}
+
+	functionPackages := make(map[string]string)
+	for _, span := range ca.FunctionSpans() {
+		functionPackages[span.Function] = span.Package
+	}
+
+	for i := range pairs {
+		pkgA, okA := functionPackages[pairs[i].A]
+		pkgB, okB := functionPackages[pairs[i].B]
+		switch {
+		case calls[[2]string{pairs[i].A, pairs[i].B}] || calls[[2]string{pairs[i].B, pairs[i].A}]:
+			pairs[i].Dependency = "call"
+		case okA && okB && pkgA == pkgB:
+			pairs[i].Dependency = "package"
+		default:
+			pairs[i].Dependency = "none"
+		}
+		pairs[i].Hidden = pairs[i].Dependency == "none"
+	}
+}
@@ -310,6 +310,23 @@ func ClearCoverageCache() error {
 	return nil
 }
 
+// ClearCoverageCacheFor drops the cached coverage of a project and of every path inside it
+func ClearCoverageCacheFor(projectPath string) error {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	cacheData, err := loadCacheFromFile()
+	if err != nil {
+		return nil
+	}
+	for key := range cacheData.Entries {
+		if key == projectPath || strings.HasPrefix(key, projectPath+string(filepath.Separator)) {
+			delete(cacheData.Entries, key)
+		}
+	}
+	return saveCacheToFile(cacheData)
+}
+
 // SetCacheDuration changes the duration for which cache entries remain valid
 func SetCacheDuration(duration time.Duration) {
 	cacheMutex.Lock()
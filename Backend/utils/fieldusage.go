@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// FieldSite represents a single place in the code where a struct field is used
+type FieldSite struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Function string `json:"function,omitempty"`
+}
+
+// FieldUsage lists every read, write and composite literal initialization of a field
+type FieldUsage struct {
+	Field            string      `json:"field"`
+	Type             string      `json:"type"`
+	Reads            []FieldSite `json:"reads"`
+	Writes           []FieldSite `json:"writes"`
+	Inits            []FieldSite `json:"inits"`
+	WrittenNeverRead bool        `json:"writtenNeverRead"`
+}
+
+// StructFieldUsage contains the usage of every field of a struct type across the loaded packages
+type StructFieldUsage struct {
+	Struct           string       `json:"struct"`
+	Package          string       `json:"package"`
+	Fields           []FieldUsage `json:"fields"`
+	WrittenNeverRead []string     `json:"writtenNeverRead"`
+}
+
+// lookupStruct finds a struct type by name. The name may be qualified with its
+// import path ("example.com/pkg.Type") or given alone when it is unambiguous
+func (ca *CallGraphAnalyzer) lookupStruct(typeName string) (*types.TypeName, *types.Struct, error) {
+	pkgPath := ""
+	if i := strings.LastIndex(typeName, "."); i > strings.LastIndex(typeName, "/") && i >= 0 {
+		pkgPath, typeName = typeName[:i], typeName[i+1:]
+	}
+
+	var found *types.TypeName
+	for _, path := range ca.PackagePaths() {
+		pkg := ca.pkgs[path]
+		if pkg.Types == nil || (pkgPath != "" && path != pkgPath) {
+			continue
+		}
+
+		obj, ok := pkg.Types.Scope().Lookup(typeName).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, nil, fmt.Errorf("struct type %s is ambiguous, qualify it with its package path", typeName)
+		}
+		found = obj
+	}
+
+	if found == nil {
+		return nil, nil, fmt.Errorf("struct type not found: %s", typeName)
+	}
+
+	structType, ok := found.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is not a struct type", typeName)
+	}
+
+	return found, structType, nil
+}
+
+// FieldUsage finds every read site, write site and composite literal initialization
+// of the fields of a struct type
+func (ca *CallGraphAnalyzer) FieldUsage(typeName string) (StructFieldUsage, error) {
+	typeObj, structType, err := ca.lookupStruct(typeName)
+	if err != nil {
+		return StructFieldUsage{}, err
+	}
+
+	usage := StructFieldUsage{
+		Struct:           typeObj.Name(),
+		Package:          typeObj.Pkg().Path(),
+		Fields:           make([]FieldUsage, structType.NumFields()),
+		WrittenNeverRead: []string{},
+	}
+
+	// Fields are matched by declaration position, which is shared by all packages loaded into the file set
+	fieldIndex := make(map[token.Pos]int, structType.NumFields())
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		fieldIndex[field.Pos()] = i
+		usage.Fields[i] = FieldUsage{
+			Field:  field.Name(),
+			Type:   types.TypeString(field.Type(), types.RelativeTo(typeObj.Pkg())),
+			Reads:  []FieldSite{},
+			Writes: []FieldSite{},
+			Inits:  []FieldSite{},
+		}
+	}
+
+	lookupField := func(obj types.Object) (int, bool) {
+		field, ok := obj.(*types.Var)
+		if !ok || !field.IsField() {
+			return 0, false
+		}
+		i, ok := fieldIndex[field.Origin().Pos()]
+		return i, ok
+	}
+
+	for _, pkgPath := range ca.PackagePaths() {
+		pkg := ca.pkgs[pkgPath]
+		if pkg.TypesInfo == nil {
+			continue
+		}
+
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				function := ""
+				if funcDecl, ok := decl.(*ast.FuncDecl); ok {
+					function = pkg.PkgPath + "." + declaredFuncName(pkg, funcDecl)
+				}
+				site := func(pos token.Pos) FieldSite {
+					position := ca.fset.Position(pos)
+					return FieldSite{
+						File:     ca.relativePath(position.Filename),
+						Line:     position.Line,
+						Column:   position.Column,
+						Function: function,
+					}
+				}
+
+				writes, readWrites := fieldWriteSelectors(decl)
+
+				ast.Inspect(decl, func(n ast.Node) bool {
+					switch n := n.(type) {
+					case *ast.SelectorExpr:
+						selection, ok := pkg.TypesInfo.Selections[n]
+						if !ok || selection.Kind() != types.FieldVal {
+							return true
+						}
+						i, ok := lookupField(selection.Obj())
+						if !ok {
+							return true
+						}
+
+						if writes[n] {
+							usage.Fields[i].Writes = append(usage.Fields[i].Writes, site(n.Sel.Pos()))
+						}
+						if !writes[n] || readWrites[n] {
+							usage.Fields[i].Reads = append(usage.Fields[i].Reads, site(n.Sel.Pos()))
+						}
+
+					case *ast.CompositeLit:
+						tv, ok := pkg.TypesInfo.Types[n]
+						if !ok {
+							return true
+						}
+						litType := tv.Type
+						if ptr, ok := litType.(*types.Pointer); ok {
+							litType = ptr.Elem()
+						}
+						if _, ok := litType.Underlying().(*types.Struct); !ok {
+							return true
+						}
+
+						for idx, elt := range n.Elts {
+							if kv, ok := elt.(*ast.KeyValueExpr); ok {
+								if key, ok := kv.Key.(*ast.Ident); ok {
+									if i, ok := lookupField(pkg.TypesInfo.Uses[key]); ok {
+										usage.Fields[i].Inits = append(usage.Fields[i].Inits, site(key.Pos()))
+									}
+								}
+								continue
+							}
+
+							// Positional literals initialize the fields in declaration order
+							if types.Identical(litType, typeObj.Type()) && idx < structType.NumFields() {
+								usage.Fields[idx].Inits = append(usage.Fields[idx].Inits, site(elt.Pos()))
+							}
+						}
+					}
+					return true
+				})
+			}
+		}
+	}
+
+	for i, field := range usage.Fields {
+		if len(field.Reads) == 0 && (len(field.Writes) > 0 || len(field.Inits) > 0) {
+			usage.Fields[i].WrittenNeverRead = true
+			usage.WrittenNeverRead = append(usage.WrittenNeverRead, field.Field)
+		}
+	}
+	sort.Strings(usage.WrittenNeverRead)
+
+	return usage, nil
+}
+
+// fieldWriteSelectors collects the selector expressions that are assigned to, incremented,
+// ranged into or have their address taken. Selectors of compound assignments such as +=
+// are also reported in readWrites because they read the field before writing it.
+func fieldWriteSelectors(root ast.Node) (writes, readWrites map[*ast.SelectorExpr]bool) {
+	writes = make(map[*ast.SelectorExpr]bool)
+	readWrites = make(map[*ast.SelectorExpr]bool)
+
+	mark := func(expr ast.Expr, alsoRead bool) {
+		if sel, ok := ast.Unparen(expr).(*ast.SelectorExpr); ok {
+			writes[sel] = true
+			if alsoRead {
+				readWrites[sel] = true
+			}
+		}
+	}
+
+	ast.Inspect(root, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			compound := n.Tok != token.ASSIGN && n.Tok != token.DEFINE
+			for _, lhs := range n.Lhs {
+				mark(lhs, compound)
+			}
+		case *ast.IncDecStmt:
+			mark(n.X, true)
+		case *ast.RangeStmt:
+			if n.Key != nil {
+				mark(n.Key, false)
+			}
+			if n.Value != nil {
+				mark(n.Value, false)
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				mark(n.X, true)
+			}
+		}
+		return true
+	})
+
+	return writes, readWrites
+}
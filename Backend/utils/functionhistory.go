@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FunctionRevision is a commit that changed a function, with the function's diff in it
+type FunctionRevision struct {
+	GitCommit
+	Diff string `json:"diff"`
+}
+
+// FunctionHistory contains the commits that shaped a function, newest first
+type FunctionHistory struct {
+	Function  string             `json:"function"`
+	File      string             `json:"file"`
+	StartLine int                `json:"startLine"`
+	EndLine   int                `json:"endLine"`
+	Revisions []FunctionRevision `json:"revisions"`
+}
+
+// GetFunctionHistory follows a function of a file back through history with
+// git log -L start,end:file and returns every commit that changed it. git resolves the
+// range against HEAD, so it is taken from the committed file rather than the working
+// tree, which may have uncommitted edits.
+func GetFunctionHistory(repoPath, filePath, functionName string) ([]FunctionRevision, error) {
+	startLine, endLine := 0, 0
+	for _, span := range funcDeclSpansAt(repoPath, "HEAD", filePath) {
+		if span.Name == functionName {
+			startLine, endLine = span.StartLine, span.EndLine
+			break
+		}
+	}
+	if startLine == 0 {
+		// Functions that were never committed have no history yet
+		return []FunctionRevision{}, nil
+	}
+
+	// Commit headers start with a NUL byte, which cannot appear in the diff of a text file
+	logOutput, err := execGitCommand(repoPath, "log", "--no-color",
+		"--format=%x00%H%x00%an%x00%ae%x00%aI%x00%s",
+		fmt.Sprintf("-L%d,%d:%s", startLine, endLine, filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git history for function: %w", err)
+	}
+
+	revisions := []FunctionRevision{}
+	for _, entry := range strings.Split(logOutput, "\n\x00") {
+		fields := strings.SplitN(strings.TrimPrefix(entry, "\x00"), "\x00", 5)
+		if len(fields) != 5 {
+			continue
+		}
+
+		message, diff, _ := strings.Cut(fields[4], "\n")
+		revisions = append(revisions, FunctionRevision{
+			GitCommit: GitCommit{
+				Hash:    fields[0],
+				Author:  fields[1],
+				Email:   fields[2],
+				Date:    fields[3],
+				Message: message,
+			},
+			Diff: strings.TrimSpace(diff),
+		})
+	}
+
+	return revisions, nil
+}
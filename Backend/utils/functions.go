@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// FunctionSpan describes where a function is declared and how complex it is
+type FunctionSpan struct {
+	Function   string `json:"function"`
+	Name       string `json:"name"`
+	Package    string `json:"package"`
+	File       string `json:"file"`
+	StartLine  int    `json:"startLine"`
+	EndLine    int    `json:"endLine"`
+	Complexity int    `json:"complexity"`
+}
+
+// FunctionSpans lists the declaration span and cyclomatic complexity of every
+// function in the loaded packages, ordered by file and line
+func (ca *CallGraphAnalyzer) FunctionSpans() []FunctionSpan {
+	spans := []FunctionSpan{}
+
+	for _, pkgPath := range ca.PackagePaths() {
+		pkg := ca.pkgs[pkgPath]
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				funcDecl, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+
+				name := declaredFuncName(pkg, funcDecl)
+				start := ca.fset.Position(funcDecl.Pos())
+				end := ca.fset.Position(funcDecl.End())
+				spans = append(spans, FunctionSpan{
+					Function:   pkg.PkgPath + "." + name,
+					Name:       name,
+					Package:    pkg.PkgPath,
+					File:       ca.relativePath(start.Filename),
+					StartLine:  start.Line,
+					EndLine:    end.Line,
+					Complexity: CyclomaticComplexity(funcDecl),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].File != spans[j].File {
+			return spans[i].File < spans[j].File
+		}
+		return spans[i].StartLine < spans[j].StartLine
+	})
+
+	return spans
+}
+
+// CyclomaticComplexity counts the independent paths through a function: one plus
+// every branch point and short-circuit boolean operator
+func CyclomaticComplexity(funcDecl *ast.FuncDecl) int {
+	complexity := 1
+	if funcDecl.Body == nil {
+		return complexity
+	}
+
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if n.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if n.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if n.Op == token.LAND || n.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+
+	return complexity
+}
@@ -1,8 +1,14 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"math"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -71,7 +77,7 @@ type FileContributor struct {
 }
 
 // getGitStats retrieves git statistics for a repository
-func GetGitStats(cleanPath string) GitStats {
+func GetGitStats(cleanPath string, rules IdentityRules) GitStats {
 	// Initialize stats object
 	stats := GitStats{
 		RepoPath: cleanPath,
@@ -92,12 +98,11 @@ func GetGitStats(cleanPath string) GitStats {
 		stats.LastCommit.Hash = strings.TrimSpace(lastCommitHash)
 
 		// Get commit details
-		commitInfo, err := execGitCommand(cleanPath, "show", "-s", "--format=%an%n%ae%n%ad%n%s", stats.LastCommit.Hash)
+		commitInfo, err := execGitCommand(cleanPath, "show", "-s", "--format=%aN%n%aE%n%ad%n%s", stats.LastCommit.Hash)
 		if err == nil {
 			lines := strings.Split(commitInfo, "\n")
 			if len(lines) >= 4 {
-				stats.LastCommit.Author = lines[0]
-				stats.LastCommit.Email = lines[1]
+				stats.LastCommit.Author, stats.LastCommit.Email = rules.Canonical(lines[0], lines[1])
 				stats.LastCommit.Date = lines[2]
 				stats.LastCommit.Message = lines[3]
 			}
@@ -111,7 +116,7 @@ func GetGitStats(cleanPath string) GitStats {
 	}
 
 	// Get contributors
-	stats.Contributors = GetContributorsWithLineStats(cleanPath)
+	stats.Contributors = GetContributorsWithLineStats(cleanPath, rules)
 
 	// Get file stats
 	stats.FileStats = GitFileStats{}
@@ -140,22 +145,6 @@ func GetGitStats(cleanPath string) GitStats {
 		}
 	}
 
-	// Calculate total lines (approximate)
-	linesOutput, err := execGitCommand(cleanPath, "ls-files", "|", "xargs", "wc", "-l")
-	if err == nil {
-		lines := strings.Split(linesOutput, "\n")
-		for _, line := range lines {
-			// Look for the total line count
-			if strings.Contains(line, "total") {
-				totalParts := strings.Fields(line)
-				if len(totalParts) >= 1 {
-					stats.FileStats.TotalLines, _ = strconv.Atoi(totalParts[0])
-				}
-				break
-			}
-		}
-	}
-
 	// Get current status
 	statusOutput, err := execGitCommand(cleanPath, "status", "--porcelain")
 	if err == nil && statusOutput != "" {
@@ -184,8 +173,11 @@ func GetGitStats(cleanPath string) GitStats {
 	return stats
 }
 
-func GetContributorsWithLineStats(repoPath string) []GitContributor {
-	// Get contributor names and emails first
+// GetContributorsWithLineStats returns the commit and line counts of every contributor.
+// Contributors are unified through .mailmap and the identity rules, and bots are left
+// out unless the rules include them.
+func GetContributorsWithLineStats(repoPath string, rules IdentityRules) []GitContributor {
+	// Get contributor names and emails first, shortlog applies .mailmap
 	contributorsData, err := execGitCommand(repoPath, "shortlog", "-sne", "HEAD")
 	if err != nil {
 		return []GitContributor{}
@@ -209,18 +201,29 @@ func GetContributorsWithLineStats(repoPath string) []GitContributor {
 
 		if len(matches) == 4 {
 			count, _ := strconv.Atoi(matches[1])
-			contributor := GitContributor{
-				Name:        matches[2],
-				Email:       matches[3],
+			name, email := rules.Canonical(matches[2], matches[3])
+			if rules.Excluded(name, email) {
+				continue
+			}
+
+			// Several mailmapped identities may share a canonical email
+			key := strings.ToLower(email)
+			if contributor, exists := contributorMap[key]; exists {
+				contributor.CommitCount += count
+				contributorMap[key] = contributor
+				continue
+			}
+			contributorMap[key] = GitContributor{
+				Name:        name,
+				Email:       email,
 				CommitCount: count,
 			}
-			contributorMap[contributor.Email] = contributor
 		}
 	}
 
 	// Now get line contribution stats
 	// Use git log with numstat to get lines added/deleted by author
-	logOutput, err := execGitCommand(repoPath, "log", "--numstat", "--pretty=format:commit %H%n%ae", ".")
+	logOutput, err := execGitCommand(repoPath, "log", "--numstat", "--pretty=format:commit %H%n%aN <%aE>", ".")
 	if err != nil {
 		// Return the contributors we already have if we can't get line stats
 		contributors := make([]GitContributor, 0, len(contributorMap))
@@ -245,9 +248,12 @@ func GetContributorsWithLineStats(repoPath string) []GitContributor {
 			continue
 		}
 
-		// Check if this is an email line
+		// Check if this is an author line
 		if strings.Contains(line, "@") && !strings.Contains(line, "\t") {
-			currentEmail = line
+			if name, email, ok := parseAuthorLine(line); ok {
+				_, email = rules.Canonical(name, email)
+				currentEmail = strings.ToLower(email)
+			}
 			continue
 		}
 
@@ -331,23 +337,180 @@ func translateGitStatus(code string) string {
 	}
 }
 
-func CloneRepo(url, dir string) error {
-	fmt.Println("Cloning repo from URL:", url)
+// CloneOptions control how a repository is cloned
+type CloneOptions struct {
+	Branch      string   `json:"branch,omitempty"`      // Branch or tag to check out instead of the default branch
+	Depth       int      `json:"depth,omitempty"`       // Number of commits of a shallow clone, the full history if 0
+	SparsePaths []string `json:"sparsePaths,omitempty"` // Directories to check out, everything if empty
+	Submodules  bool     `json:"submodules,omitempty"`  // Clone submodules as well
+	Token       string   `json:"token,omitempty"`       // Access token for https remotes
+	SSHKeyPath  string   `json:"sshKeyPath,omitempty"`  // Private key for ssh remotes
+}
+
+// CloneProgress reports how far a stage of git clone got
+type CloneProgress struct {
+	Stage   string `json:"stage"` // Such as Receiving objects or Resolving deltas
+	Percent int    `json:"percent"`
+}
+
+// cloneProgressLine matches the progress git clone prints to stderr
+var cloneProgressLine = regexp.MustCompile(`^(?:remote: )?([A-Za-z ]+):\s+(\d+)%`)
+
+// CloneRepo clones the repository at url into dir. Credentials are handed to git through
+// its environment, so they never show up in the process list or the clone's config.
+func CloneRepo(url, dir string, options CloneOptions) error {
+	return CloneRepoContext(context.Background(), url, dir, options, nil)
+}
+
+// CloneRepoContext clones like CloneRepo, reporting the progress of git to progress if it is
+// set. The clone is aborted when ctx is canceled.
+func CloneRepoContext(ctx context.Context, url, dir string, options CloneOptions, progress func(CloneProgress)) error {
+	remote, err := ParseRemoteURL(url)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Cloning repo from URL:", RedactURL(url))
 	fmt.Println("Cloning to directory:", dir)
 
-	// Execute git clone command
-	cmd := exec.Command("git", "clone", url, dir)
-	// cmd.Stdout = os.Stdout
-	// cmd.Stderr = os.Stderr
+	args := []string{"clone", "--progress"}
+	if options.Branch != "" {
+		args = append(args, "--branch", options.Branch)
+	}
+	if options.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(options.Depth))
+	}
+	if len(options.SparsePaths) > 0 {
+		args = append(args, "--sparse")
+	}
+	if options.Submodules {
+		args = append(args, "--recurse-submodules")
+		if options.Depth > 0 {
+			args = append(args, "--shallow-submodules")
+		}
+	}
+	args = append(args, "--", url, dir)
 
-	if err := cmd.Run(); err != nil {
+	env, err := cloneEnv(remote, options)
+	if err != nil {
+		return err
+	}
+
+	// Execute git clone command
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = env
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("git clone failed: %w", err)
 	}
 
+	// Progress lines are rewritten in place with carriage returns
+	var output strings.Builder
+	last := CloneProgress{}
+	scanner := bufio.NewScanner(stderr)
+	scanner.Split(scanProgressLines)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		match := cloneProgressLine.FindStringSubmatch(line)
+		if match == nil {
+			if line != "" {
+				output.WriteString(line + "\n")
+			}
+			continue
+		}
+		percent, _ := strconv.Atoi(match[2])
+		current := CloneProgress{Stage: match[1], Percent: percent}
+		if progress != nil && current != last {
+			progress(current)
+		}
+		last = current
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		message := strings.ReplaceAll(strings.TrimSpace(output.String()), url, RedactURL(url))
+		return fmt.Errorf("git clone failed: %v: %s", err, message)
+	}
+
+	if len(options.SparsePaths) > 0 {
+		sparseArgs := append([]string{"sparse-checkout", "set", "--"}, options.SparsePaths...)
+		cmd := exec.CommandContext(ctx, "git", sparseArgs...)
+		cmd.Dir = dir
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git sparse-checkout failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+
 	return nil
 }
 
-func GetFileContributions(cleanPath, filePath string) ([]FileContributor, error) {
+// scanProgressLines splits output into lines ending with a newline or a carriage return
+func scanProgressLines(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// cloneEnv returns the environment of git commands cloning a remote with the given credentials
+func cloneEnv(remote RemoteURL, options CloneOptions) ([]string, error) {
+	// Fail instead of waiting for a password on the terminal
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	if options.Token != "" {
+		// Plain http would send the token in cleartext
+		parsed, err := url.Parse(strings.TrimSpace(remote.Raw))
+		if remote.Kind != RemoteHTTPS || err != nil || parsed.Scheme != "https" {
+			return nil, errors.New("a token can only be used with https remotes")
+		}
+		// The header is scoped to the repo's host so submodules elsewhere never see it
+		credentials := base64.StdEncoding.EncodeToString([]byte(remote.tokenUser() + ":" + options.Token))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.https://"+parsed.Host+"/.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+
+	if options.SSHKeyPath != "" {
+		if remote.Kind != RemoteSSH {
+			return nil, errors.New("an ssh key can only be used with ssh remotes")
+		}
+		keyPath := options.SSHKeyPath
+		if rest, ok := strings.CutPrefix(keyPath, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			keyPath = filepath.Join(home, rest)
+		}
+		keyPath, err := filepath.Abs(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(keyPath); err != nil {
+			return nil, fmt.Errorf("ssh key not found: %s", options.SSHKeyPath)
+		}
+		// GIT_SSH_COMMAND goes through the shell, so the path is single quoted
+		quoted := "'" + strings.ReplaceAll(keyPath, "'", `'\''`) + "'"
+		env = append(env, "GIT_SSH_COMMAND=ssh -i "+quoted+" -o IdentitiesOnly=yes")
+	}
+
+	return env, nil
+}
+
+// GetFileContributions returns the commit and line counts of every contributor to a file,
+// unified and filtered like GetContributorsWithLineStats
+func GetFileContributions(cleanPath, filePath string, rules IdentityRules) ([]FileContributor, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -359,7 +522,7 @@ func GetFileContributions(cleanPath, filePath string) ([]FileContributor, error)
 	contribMap := make(map[string]FileContributor)
 
 	// First get commit counts
-	logOutput, err := execGitCommand(cleanPath, "log", "--follow", "--pretty=format:%an <%ae>", "--", filePath)
+	logOutput, err := execGitCommand(cleanPath, "log", "--follow", "--pretty=format:%aN <%aE>", "--", filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get git log for file: %w", err)
 	}
@@ -372,9 +535,11 @@ func GetFileContributions(cleanPath, filePath string) ([]FileContributor, error)
 			re := regexp.MustCompile(`^(.*) <(.*)>$`)
 			matches := re.FindStringSubmatch(author)
 			if len(matches) == 3 {
-				name := matches[1]
-				email := matches[2]
-				key := name + " <" + email + ">"
+				name, email := rules.Canonical(matches[1], matches[2])
+				if rules.Excluded(name, email) {
+					continue
+				}
+				key := strings.ToLower(email)
 
 				if contrib, exists := contribMap[key]; exists {
 					contrib.CommitCount++
@@ -391,7 +556,7 @@ func GetFileContributions(cleanPath, filePath string) ([]FileContributor, error)
 	}
 
 	// Now get line stats for the file
-	numstatOutput, err := execGitCommand(cleanPath, "log", "--follow", "--numstat", "--format=commit %H%n%an <%ae>", "--", filePath)
+	numstatOutput, err := execGitCommand(cleanPath, "log", "--follow", "--numstat", "--format=commit %H%n%aN <%aE>", "--", filePath)
 	if err != nil {
 		print(err)
 		// Return just commit counts if we can't get line stats
@@ -422,7 +587,8 @@ func GetFileContributions(cleanPath, filePath string) ([]FileContributor, error)
 		// Check if this is an author line (contains email in <>)
 		re := regexp.MustCompile(`^(.*) <(.*)>$`)
 		if matches := re.FindStringSubmatch(line); len(matches) == 3 {
-			currentAuthor = line // Store the full "Name <email>" as the key
+			_, email := rules.Canonical(matches[1], matches[2])
+			currentAuthor = strings.ToLower(email) // Store the canonical email as the key
 			continue
 		}
 
@@ -0,0 +1,363 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChangeFrequency contains how often a file or function was changed in the git history
+type ChangeFrequency struct {
+	Commits      int `json:"commits"`
+	LinesAdded   int `json:"linesAdded"`
+	LinesDeleted int `json:"linesDeleted"`
+}
+
+// Hotspot represents a file or function ranked by its combination of churn and complexity
+type Hotspot struct {
+	Rank         int     `json:"rank"`
+	Kind         string  `json:"kind"` // file or function
+	Name         string  `json:"name"`
+	Package      string  `json:"package,omitempty"`
+	File         string  `json:"file"`
+	Line         int     `json:"line,omitempty"`
+	Lines        int     `json:"lines"`
+	Commits      int     `json:"commits"`
+	LinesChanged int     `json:"linesChanged"`
+	Complexity   int     `json:"complexity"`
+	Score        float64 `json:"score"`
+}
+
+// HotspotNode is a node of the treemap hierarchy: directories contain files and
+// files contain functions. Only leaves carry a Value, the size of the rectangle.
+type HotspotNode struct {
+	Name       string        `json:"name"`
+	Path       string        `json:"path"`
+	Kind       string        `json:"kind"` // directory, file or function
+	Value      int           `json:"value,omitempty"`
+	Commits    int           `json:"commits"`
+	Complexity int           `json:"complexity"`
+	Score      float64       `json:"score"`
+	Children   []HotspotNode `json:"children,omitempty"`
+}
+
+// HotspotReport contains the ranked hotspots of a project and their treemap
+type HotspotReport struct {
+	Since     string      `json:"since,omitempty"`
+	Files     []Hotspot   `json:"files"`
+	Functions []Hotspot   `json:"functions"`
+	Treemap   HotspotNode `json:"treemap"`
+}
+
+var (
+	hunkHeaderRegex = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+\d+(?:,\d+)? @@ ?(.*)$`)
+	goFuncRegex     = regexp.MustCompile(`^func(?:\s*\(\s*(?:\w+\s+)?\*?\s*(\w+)(?:\[[^\]]*\])?\s*\))?\s+(\w+)\s*[\[(]`)
+)
+
+// ResolveSince turns anything git log --since accepts into the start of its day in UTC,
+// formatted so git reads it back unchanged. Every spelling of a date then gives the same
+// value, which bounds the reports cached per date. An empty since stays empty.
+func ResolveSince(repoPath, since string) (string, error) {
+	if since == "" {
+		return "", nil
+	}
+	output, err := execGitCommand(repoPath, "rev-parse", "--since="+since)
+	if err != nil {
+		return "", fmt.Errorf("invalid since date: %s", since)
+	}
+	seconds, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(output), "--max-age="), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid since date: %s", since)
+	}
+	return time.Unix(seconds, 0).UTC().Truncate(24 * time.Hour).Format(time.RFC3339), nil
+}
+
+// goFuncName extracts the registered function name ("Recv.Name" for methods)
+// from a line of Go source starting with a function declaration
+func goFuncName(line string) string {
+	matches := goFuncRegex.FindStringSubmatch(strings.TrimSpace(line))
+	if matches == nil {
+		return ""
+	}
+	if matches[1] != "" {
+		return matches[1] + "." + matches[2]
+	}
+	return matches[2]
+}
+
+// GetFileChurn counts the commits and changed lines of every file below repoPath,
+// keyed by path relative to repoPath. An empty since covers the whole history.
+func GetFileChurn(repoPath, since string) (map[string]ChangeFrequency, error) {
+	args := []string{"log", "--numstat", "--relative", "--no-renames", "--format=commit %H"}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+
+	logOutput, err := execGitCommand(repoPath, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	churn := make(map[string]ChangeFrequency)
+	for _, line := range strings.Split(logOutput, "\n") {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 {
+			continue
+		}
+
+		// Binary files report "-" for both counts
+		added, _ := strconv.Atoi(parts[0])
+		deleted, _ := strconv.Atoi(parts[1])
+
+		stats := churn[parts[2]]
+		stats.Commits++
+		stats.LinesAdded += added
+		stats.LinesDeleted += deleted
+		churn[parts[2]] = stats
+	}
+
+	return churn, nil
+}
+
+// GetFunctionChurn counts the commits changing every Go function below repoPath, keyed
+// by "file#Name". Changed lines are attributed to the function named in their hunk header,
+// which git takes from the closest preceding declaration, or to a function declared
+// earlier in the same hunk.
+func GetFunctionChurn(repoPath, since string) (map[string]ChangeFrequency, error) {
+	args := []string{"log", "-p", "-U0", "--relative", "--no-renames", "--no-color", "--format=commit %H"}
+	if since != "" {
+		args = append(args, "--since="+since)
+	}
+	args = append(args, "--", "*.go")
+
+	logOutput, err := execGitCommand(repoPath, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	churn := make(map[string]ChangeFrequency)
+	touched := make(map[string]bool)
+	currentFile := ""
+
+	// Each function counts once per commit, however many hunks touch it
+	flush := func() {
+		for key := range touched {
+			stats := churn[key]
+			stats.Commits++
+			churn[key] = stats
+		}
+		touched = make(map[string]bool)
+	}
+	touch := func(name string, added, deleted int) {
+		if name == "" || currentFile == "" {
+			return
+		}
+		key := currentFile + "#" + name
+		touched[key] = true
+		stats := churn[key]
+		stats.LinesAdded += added
+		stats.LinesDeleted += deleted
+		churn[key] = stats
+	}
+
+	hunkFunction := ""
+	inHeader := false
+	for _, line := range strings.Split(logOutput, "\n") {
+		switch {
+		case strings.HasPrefix(line, "commit "):
+			flush()
+			currentFile = ""
+		case strings.HasPrefix(line, "diff --git "):
+			inHeader = true
+		case inHeader && strings.HasPrefix(line, "--- "):
+			if name := strings.TrimPrefix(line, "--- "); name != "/dev/null" {
+				currentFile = strings.TrimPrefix(name, "a/")
+			}
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			if name := strings.TrimPrefix(line, "+++ "); name != "/dev/null" {
+				currentFile = strings.TrimPrefix(name, "b/")
+			}
+		case strings.HasPrefix(line, "@@"):
+			inHeader = false
+			hunkFunction = ""
+			if matches := hunkHeaderRegex.FindStringSubmatch(line); matches != nil {
+				hunkFunction = goFuncName(matches[1])
+			}
+		case !inHeader && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")):
+			added, deleted := 0, 1
+			if line[0] == '+' {
+				added, deleted = 1, 0
+			}
+			// Blank and comment lines between declarations belong to no function
+			if content := strings.TrimSpace(line[1:]); content == "" || strings.HasPrefix(content, "//") {
+				continue
+			}
+			// Lines after a declaration inside the hunk belong to the declared function
+			if name := goFuncName(line[1:]); name != "" {
+				hunkFunction = name
+			}
+			touch(hunkFunction, added, deleted)
+		}
+	}
+	flush()
+
+	return churn, nil
+}
+
+// BuildHotspots ranks the files and functions of the analyzer by churn times complexity.
+// Both factors are normalized against the project maximum, so scores range from 0 to 100.
+func BuildHotspots(ca *CallGraphAnalyzer, fileChurn, functionChurn map[string]ChangeFrequency) HotspotReport {
+	report := HotspotReport{
+		Files:     []Hotspot{},
+		Functions: []Hotspot{},
+	}
+
+	files := make(map[string]*Hotspot)
+	for _, span := range ca.FunctionSpans() {
+		churn := functionChurn[span.File+"#"+span.Name]
+		report.Functions = append(report.Functions, Hotspot{
+			Kind:         "function",
+			Name:         span.Name,
+			Package:      span.Package,
+			File:         span.File,
+			Line:         span.StartLine,
+			Lines:        span.EndLine - span.StartLine + 1,
+			Commits:      churn.Commits,
+			LinesChanged: churn.LinesAdded + churn.LinesDeleted,
+			Complexity:   span.Complexity,
+		})
+
+		if files[span.File] == nil {
+			churn := fileChurn[span.File]
+			files[span.File] = &Hotspot{
+				Kind:         "file",
+				Name:         path.Base(span.File),
+				File:         span.File,
+				Commits:      churn.Commits,
+				LinesChanged: churn.LinesAdded + churn.LinesDeleted,
+			}
+		}
+		files[span.File].Complexity += span.Complexity
+	}
+
+	for _, pkgPath := range ca.PackagePaths() {
+		for _, file := range ca.pkgs[pkgPath].Syntax {
+			if tokenFile := ca.fset.File(file.Pos()); tokenFile != nil {
+				if hotspot := files[ca.relativePath(tokenFile.Name())]; hotspot != nil {
+					hotspot.Lines = tokenFile.LineCount()
+				}
+			}
+		}
+	}
+	for _, hotspot := range files {
+		report.Files = append(report.Files, *hotspot)
+	}
+
+	rankHotspots(report.Files)
+	rankHotspots(report.Functions)
+	report.Treemap = buildHotspotTreemap(report.Files, report.Functions)
+
+	return report
+}
+
+// rankHotspots scores and sorts hotspots, highest score first
+func rankHotspots(hotspots []Hotspot) {
+	maxCommits, maxComplexity := 0, 0
+	for _, hotspot := range hotspots {
+		maxCommits = max(maxCommits, hotspot.Commits)
+		maxComplexity = max(maxComplexity, hotspot.Complexity)
+	}
+
+	for i := range hotspots {
+		if maxCommits > 0 && maxComplexity > 0 {
+			churn := float64(hotspots[i].Commits) / float64(maxCommits)
+			complexity := float64(hotspots[i].Complexity) / float64(maxComplexity)
+			hotspots[i].Score = math.Round(churn * complexity * 100)
+		}
+	}
+
+	sort.SliceStable(hotspots, func(i, j int) bool {
+		if hotspots[i].Score != hotspots[j].Score {
+			return hotspots[i].Score > hotspots[j].Score
+		}
+		return hotspots[i].Name < hotspots[j].Name
+	})
+	for i := range hotspots {
+		hotspots[i].Rank = i + 1
+	}
+}
+
+// buildHotspotTreemap arranges the hotspots in a directory hierarchy
+func buildHotspotTreemap(files, functions []Hotspot) HotspotNode {
+	fileFunctions := make(map[string][]HotspotNode)
+	for _, function := range functions {
+		fileFunctions[function.File] = append(fileFunctions[function.File], HotspotNode{
+			Name:       function.Name,
+			Path:       function.File + "#" + strconv.Itoa(function.Line),
+			Kind:       "function",
+			Value:      function.Lines,
+			Commits:    function.Commits,
+			Complexity: function.Complexity,
+			Score:      function.Score,
+		})
+	}
+
+	root := &HotspotNode{Name: ".", Path: "", Kind: "directory"}
+	for _, file := range files {
+		node := root
+		dirs := strings.Split(path.Dir(file.File), "/")
+		for i, dir := range dirs {
+			if dir == "." {
+				continue
+			}
+			node = node.childDirectory(dir, strings.Join(dirs[:i+1], "/"))
+		}
+
+		fileNode := HotspotNode{
+			Name:       file.Name,
+			Path:       file.File,
+			Kind:       "file",
+			Commits:    file.Commits,
+			Complexity: file.Complexity,
+			Score:      file.Score,
+			Children:   fileFunctions[file.File],
+		}
+		if len(fileNode.Children) == 0 {
+			fileNode.Value = file.Lines
+		}
+		node.Children = append(node.Children, fileNode)
+	}
+
+	root.aggregate()
+	return *root
+}
+
+// childDirectory returns the directory child with the given name, creating it if needed
+func (n *HotspotNode) childDirectory(name, dirPath string) *HotspotNode {
+	for i := range n.Children {
+		if n.Children[i].Kind == "directory" && n.Children[i].Name == name {
+			return &n.Children[i]
+		}
+	}
+	n.Children = append(n.Children, HotspotNode{Name: name, Path: dirPath, Kind: "directory"})
+	return &n.Children[len(n.Children)-1]
+}
+
+// aggregate sums commits and complexity of directories and keeps their highest child score
+func (n *HotspotNode) aggregate() {
+	if n.Kind != "directory" {
+		return
+	}
+	n.Commits, n.Complexity, n.Score = 0, 0, 0
+	for i := range n.Children {
+		n.Children[i].aggregate()
+		n.Commits += n.Children[i].Commits
+		n.Complexity += n.Children[i].Complexity
+		n.Score = math.Max(n.Score, n.Children[i].Score)
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestResolveSince(t *testing.T) {
+	repo := t.TempDir()
+	gitFixture(t, repo, "init", "-q")
+
+	tests := []struct {
+		since    string
+		resolved string
+	}{
+		{"", ""},
+		{"2024-01-01T00:00:00Z", "2024-01-01T00:00:00Z"},
+		{"2024-01-01T17:30:00Z", "2024-01-01T00:00:00Z"},
+		{"2024-01-01 12:00 +0000", "2024-01-01T00:00:00Z"},
+	}
+	for _, test := range tests {
+		resolved, err := ResolveSince(repo, test.since)
+		if err != nil {
+			t.Fatalf("ResolveSince(%q): %v", test.since, err)
+		}
+		if resolved != test.resolved {
+			t.Errorf("ResolveSince(%q) = %q, want %q", test.since, resolved, test.resolved)
+		}
+	}
+
+	relative, err := ResolveSince(repo, "2 weeks ago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ResolveSince(repo, "14 days ago")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relative != again {
+		t.Errorf("2 weeks ago resolved to %s but 14 days ago to %s", relative, again)
+	}
+}
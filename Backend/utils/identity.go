@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IdentityRulesFile is the default name of the contributor identity rules file
+const IdentityRulesFile = ".codeviz-identities.yml"
+
+// DefaultBotPatterns match the names and emails of common automation accounts.
+// Patterns use path.Match syntax, so literal brackets are escaped.
+var DefaultBotPatterns = []string{
+	`*\[bot\]`,
+	`*\[bot\]@*`,
+	"dependabot*",
+	"renovate*",
+	"github-actions*",
+	"greenkeeper*",
+	"snyk-bot*",
+}
+
+// IdentityRules unify contributors on top of .mailmap and decide which are bots
+type IdentityRules struct {
+	Aliases     []IdentityAlias `yaml:"aliases" json:"aliases"`
+	Bots        []string        `yaml:"bots" json:"bots"`               // Patterns added to DefaultBotPatterns
+	IncludeBots bool            `yaml:"includeBots" json:"includeBots"` // Keep bots in contributor stats
+}
+
+// IdentityAlias maps several names or emails onto one canonical contributor
+type IdentityAlias struct {
+	Name   string   `yaml:"name" json:"name"`
+	Email  string   `yaml:"email" json:"email"`
+	Emails []string `yaml:"emails,omitempty" json:"emails,omitempty"`
+	Names  []string `yaml:"names,omitempty" json:"names,omitempty"`
+}
+
+// Identity is a unified contributor with every name and email it committed under
+type Identity struct {
+	Name    string   `json:"name"`
+	Email   string   `json:"email"`
+	Aliases []string `json:"aliases"`
+	Commits int      `json:"commits"`
+	Bot     bool     `json:"bot"`
+}
+
+// IdentityReport lists the contributors of a repository after unification
+type IdentityReport struct {
+	ServerRulesFile string        `json:"serverRulesFile,omitempty"`
+	RulesFile       string        `json:"rulesFile,omitempty"`
+	Rules           IdentityRules `json:"rules"`
+	Identities      []Identity    `json:"identities"`
+}
+
+// LoadIdentityRules reads an identity rules file. A missing file yields empty rules.
+func LoadIdentityRules(rulesPath string) (IdentityRules, error) {
+	var rules IdentityRules
+
+	data, err := os.ReadFile(rulesPath)
+	if os.IsNotExist(err) {
+		return rules, nil
+	}
+	if err != nil {
+		return rules, fmt.Errorf("failed to read identity rules: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("failed to parse identity rules: %w", err)
+	}
+
+	for _, alias := range rules.Aliases {
+		if alias.Email == "" {
+			return rules, fmt.Errorf("identity alias %q without an email", alias.Name)
+		}
+	}
+	for _, pattern := range rules.Bots {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return rules, fmt.Errorf("invalid bot pattern %q", pattern)
+		}
+	}
+
+	return rules, nil
+}
+
+// Merge combines the rules of a repository with rules applying to every repository.
+// The repository's aliases come first so they win when both match a contributor, bot
+// patterns add up, and bots are kept if either asks for it.
+func (r IdentityRules) Merge(shared IdentityRules) IdentityRules {
+	return IdentityRules{
+		Aliases:     append(append([]IdentityAlias{}, r.Aliases...), shared.Aliases...),
+		Bots:        append(append([]string{}, r.Bots...), shared.Bots...),
+		IncludeBots: r.IncludeBots || shared.IncludeBots,
+	}
+}
+
+// Canonical returns the canonical name and email of a contributor. The name and email
+// should already be mapped through .mailmap, as git does for %aN and %aE.
+func (r IdentityRules) Canonical(name, email string) (string, string) {
+	for _, alias := range r.Aliases {
+		matches := strings.EqualFold(alias.Email, email)
+		for _, aliasEmail := range alias.Emails {
+			matches = matches || strings.EqualFold(aliasEmail, email)
+		}
+		for _, aliasName := range alias.Names {
+			matches = matches || aliasName == name
+		}
+		if !matches {
+			continue
+		}
+
+		if alias.Name != "" {
+			name = alias.Name
+		}
+		return name, alias.Email
+	}
+	return name, email
+}
+
+// IsBot reports whether the name or email of a contributor matches a bot pattern
+func (r IdentityRules) IsBot(name, email string) bool {
+	patterns := append(append([]string{}, DefaultBotPatterns...), r.Bots...)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		for _, value := range []string{name, email} {
+			if matched, _ := path.Match(pattern, strings.ToLower(value)); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Excluded reports whether a contributor is left out of contributor stats
+func (r IdentityRules) Excluded(name, email string) bool {
+	return !r.IncludeBots && r.IsBot(name, email)
+}
+
+// ResolveIdentities lists the unified contributors of the history below repoPath
+// with the raw names and emails that were merged into them
+func ResolveIdentities(repoPath string, rules IdentityRules) ([]Identity, error) {
+	logOutput, err := execGitCommand(repoPath, "log", "--format=%an%x00%ae%x00%aN%x00%aE", "--", ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git log: %w", err)
+	}
+
+	identities := make(map[string]*Identity)
+	aliases := make(map[string]map[string]bool)
+	for _, line := range strings.Split(logOutput, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+
+		name, email := rules.Canonical(fields[2], fields[3])
+		key := strings.ToLower(email)
+		identity, ok := identities[key]
+		if !ok {
+			identity = &Identity{Name: name, Email: email, Bot: rules.IsBot(name, email)}
+			identities[key] = identity
+			aliases[key] = make(map[string]bool)
+		}
+		identity.Commits++
+		aliases[key][fields[0]+" <"+fields[1]+">"] = true
+	}
+
+	result := make([]Identity, 0, len(identities))
+	for key, identity := range identities {
+		identity.Aliases = sortedKeys(aliases[key])
+		result = append(result, *identity)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Commits != result[j].Commits {
+			return result[i].Commits > result[j].Commits
+		}
+		return result[i].Email < result[j].Email
+	})
+
+	return result, nil
+}
+
+// parseAuthorLine splits a "Name <email>" line
+func parseAuthorLine(line string) (string, string, bool) {
+	open := strings.LastIndex(line, " <")
+	if open < 0 || !strings.HasSuffix(line, ">") {
+		return "", "", false
+	}
+	return line[:open], line[open+2 : len(line)-1], true
+}
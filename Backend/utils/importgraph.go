@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"sort"
+	"strconv"
+)
+
+// ImportEdge represents a single import declaration of a loaded package
+type ImportEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// PackagePaths returns the import paths of all loaded packages, sorted.
+// Directories without Go files are loaded as empty packages and are skipped.
+func (ca *CallGraphAnalyzer) PackagePaths() []string {
+	pkgPaths := make([]string, 0, len(ca.pkgs))
+	for pkgPath, pkg := range ca.pkgs {
+		if len(pkg.Syntax) == 0 {
+			continue
+		}
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
+	return pkgPaths
+}
+
+// ImportEdges lists every import declaration in the loaded packages, including
+// imports of standard library and third party packages
+func (ca *CallGraphAnalyzer) ImportEdges() []ImportEdge {
+	var edges []ImportEdge
+	for _, pkgPath := range ca.PackagePaths() {
+		pkg := ca.pkgs[pkgPath]
+		for _, file := range pkg.Syntax {
+			for _, spec := range file.Imports {
+				importPath, err := strconv.Unquote(spec.Path.Value)
+				if err != nil {
+					continue
+				}
+
+				position := ca.fset.Position(spec.Pos())
+				edges = append(edges, ImportEdge{
+					From: pkg.PkgPath,
+					To:   importPath,
+					File: ca.relativePath(position.Filename),
+					Line: position.Line,
+				})
+			}
+		}
+	}
+	return edges
+}
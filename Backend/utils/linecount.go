@@ -0,0 +1,319 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// language describes how comments are written in a programming language
+type language struct {
+	Name         string
+	LineComments []string
+	BlockStart   string
+	BlockEnd     string
+}
+
+var (
+	cStyle    = language{LineComments: []string{"//"}, BlockStart: "/*", BlockEnd: "*/"}
+	hashStyle = language{LineComments: []string{"#"}}
+	markup    = language{BlockStart: "<!--", BlockEnd: "-->"}
+	plain     = language{}
+)
+
+// withName returns a copy of the comment style for a named language
+func (l language) withName(name string) language {
+	l.Name = name
+	return l
+}
+
+// languagesByExtension maps file extensions to the language they contain
+var languagesByExtension = map[string]language{
+	".go":    cStyle.withName("Go"),
+	".js":    cStyle.withName("JavaScript"),
+	".jsx":   cStyle.withName("JavaScript"),
+	".mjs":   cStyle.withName("JavaScript"),
+	".ts":    cStyle.withName("TypeScript"),
+	".tsx":   cStyle.withName("TypeScript"),
+	".java":  cStyle.withName("Java"),
+	".kt":    cStyle.withName("Kotlin"),
+	".c":     cStyle.withName("C"),
+	".h":     cStyle.withName("C/C++ Header"),
+	".cc":    cStyle.withName("C++"),
+	".cpp":   cStyle.withName("C++"),
+	".hpp":   cStyle.withName("C/C++ Header"),
+	".cs":    cStyle.withName("C#"),
+	".rs":    cStyle.withName("Rust"),
+	".swift": cStyle.withName("Swift"),
+	".scala": cStyle.withName("Scala"),
+	".proto": cStyle.withName("Protocol Buffers"),
+	".css":   language{BlockStart: "/*", BlockEnd: "*/"}.withName("CSS"),
+	".scss":  cStyle.withName("SCSS"),
+	".py":    hashStyle.withName("Python"),
+	".rb":    hashStyle.withName("Ruby"),
+	".sh":    hashStyle.withName("Shell"),
+	".bash":  hashStyle.withName("Shell"),
+	".yml":   hashStyle.withName("YAML"),
+	".yaml":  hashStyle.withName("YAML"),
+	".toml":  hashStyle.withName("TOML"),
+	".pl":    hashStyle.withName("Perl"),
+	".r":     hashStyle.withName("R"),
+	".sql":   language{LineComments: []string{"--"}, BlockStart: "/*", BlockEnd: "*/"}.withName("SQL"),
+	".lua":   language{LineComments: []string{"--"}}.withName("Lua"),
+	".html":  markup.withName("HTML"),
+	".htm":   markup.withName("HTML"),
+	".xml":   markup.withName("XML"),
+	".vue":   markup.withName("Vue"),
+	".md":    markup.withName("Markdown"),
+	".json":  plain.withName("JSON"),
+	".mod":   language{LineComments: []string{"//"}}.withName("Go Module"),
+	".sum":   plain.withName("Go Checksums"),
+}
+
+// languagesByName maps well-known file names without a telling extension
+var languagesByName = map[string]language{
+	"Makefile":   hashStyle.withName("Makefile"),
+	"Dockerfile": hashStyle.withName("Dockerfile"),
+}
+
+// LineCounts contains the number of code, comment and blank lines of some files
+type LineCounts struct {
+	Files    int `json:"files"`
+	Code     int `json:"code"`
+	Comments int `json:"comments"`
+	Blank    int `json:"blank"`
+	Total    int `json:"total"`
+}
+
+// FileLineCount contains the line counts of a single file
+type FileLineCount struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	LineCounts
+}
+
+// LanguageLineCount contains the line counts of every file of a language
+type LanguageLineCount struct {
+	Language string `json:"language"`
+	LineCounts
+}
+
+// DirectoryLineCount contains the line counts of every file below a directory
+type DirectoryLineCount struct {
+	Path string `json:"path"`
+	LineCounts
+}
+
+// LineCountReport contains the line counts of a project per language, directory and file
+type LineCountReport struct {
+	Total       LineCounts           `json:"total"`
+	Languages   []LanguageLineCount  `json:"languages"`
+	Directories []DirectoryLineCount `json:"directories"`
+	Files       []FileLineCount      `json:"files"`
+}
+
+// add accumulates the counts of a file
+func (c *LineCounts) add(other LineCounts) {
+	c.Files += other.Files
+	c.Code += other.Code
+	c.Comments += other.Comments
+	c.Blank += other.Blank
+	c.Total += other.Total
+}
+
+// CountLines counts the code, comment and blank lines of every source file below root,
+// like cloc. Entries for which ignore returns true are skipped along with their contents,
+// and files in unknown languages or with binary content are not counted.
+func CountLines(root string, ignore func(name string) bool) (LineCountReport, error) {
+	report := LineCountReport{
+		Languages:   []LanguageLineCount{},
+		Directories: []DirectoryLineCount{},
+		Files:       []FileLineCount{},
+	}
+	languages := make(map[string]*LineCounts)
+	directories := make(map[string]*LineCounts)
+
+	err := filepath.WalkDir(root, func(filePath string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath != root && ignore(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		lang, ok := languagesByName[d.Name()]
+		if !ok {
+			if lang, ok = languagesByExtension[strings.ToLower(filepath.Ext(d.Name()))]; !ok {
+				return nil
+			}
+		}
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil
+		}
+		counts, ok := countFileLines(data, lang)
+		if !ok {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+		report.Files = append(report.Files, FileLineCount{Path: relPath, Language: lang.Name, LineCounts: counts})
+		report.Total.add(counts)
+
+		if languages[lang.Name] == nil {
+			languages[lang.Name] = &LineCounts{}
+		}
+		languages[lang.Name].add(counts)
+
+		// Every directory above the file includes its lines
+		for dir := path.Dir(relPath); ; dir = path.Dir(dir) {
+			if directories[dir] == nil {
+				directories[dir] = &LineCounts{}
+			}
+			directories[dir].add(counts)
+			if dir == "." {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for name, counts := range languages {
+		report.Languages = append(report.Languages, LanguageLineCount{Language: name, LineCounts: *counts})
+	}
+	sort.Slice(report.Languages, func(i, j int) bool {
+		if report.Languages[i].Code != report.Languages[j].Code {
+			return report.Languages[i].Code > report.Languages[j].Code
+		}
+		return report.Languages[i].Language < report.Languages[j].Language
+	})
+
+	for dir, counts := range directories {
+		report.Directories = append(report.Directories, DirectoryLineCount{Path: dir, LineCounts: *counts})
+	}
+	sort.Slice(report.Directories, func(i, j int) bool {
+		return report.Directories[i].Path < report.Directories[j].Path
+	})
+
+	return report, nil
+}
+
+// countFileLines classifies every line of a file. It reports false for binary content.
+// Comment markers inside string literals are not recognized, as in most line counters.
+func countFileLines(data []byte, lang language) (LineCounts, bool) {
+	if bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+		return LineCounts{}, false
+	}
+
+	counts := LineCounts{Files: 1}
+	if len(data) == 0 {
+		return counts, true
+	}
+
+	inBlock := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		counts.Total++
+
+		code := false
+		switch {
+		case inBlock:
+			code, inBlock = lang.afterBlock(line)
+		case line == "":
+			counts.Blank++
+			continue
+		case lang.BlockStart != "" && strings.HasPrefix(line, lang.BlockStart):
+			code, inBlock = lang.afterBlock(line[len(lang.BlockStart):])
+		case lang.isComment(line):
+		default:
+			code = true
+			inBlock = lang.opensBlock(line)
+		}
+
+		if code {
+			counts.Code++
+		} else {
+			counts.Comments++
+		}
+	}
+
+	return counts, true
+}
+
+// afterBlock looks at the rest of a line inside a block comment. It reports whether
+// code follows the end of the comment, and whether a block comment is still open at
+// the end of the line.
+func (l language) afterBlock(rest string) (bool, bool) {
+	end := strings.Index(rest, l.BlockEnd)
+	if end < 0 {
+		return false, true
+	}
+	rest = strings.TrimSpace(rest[end+len(l.BlockEnd):])
+	switch {
+	case rest == "":
+		return false, false
+	case strings.HasPrefix(rest, l.BlockStart):
+		return l.afterBlock(rest[len(l.BlockStart):])
+	case l.isComment(rest):
+		return false, false
+	}
+	return true, l.opensBlock(rest)
+}
+
+// isComment reports whether a trimmed line starts with a comment
+func (l language) isComment(line string) bool {
+	for _, prefix := range l.LineComments {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return l.BlockStart != "" && strings.HasPrefix(line, l.BlockStart)
+}
+
+// opensBlock reports whether a line leaves a block comment open at its end
+func (l language) opensBlock(line string) bool {
+	if l.BlockStart == "" {
+		return false
+	}
+	open := false
+	for {
+		if !open {
+			start := strings.Index(line, l.BlockStart)
+			if start < 0 {
+				return false
+			}
+			// A line comment before the block start hides it
+			for _, prefix := range l.LineComments {
+				if comment := strings.Index(line, prefix); comment >= 0 && comment < start {
+					return false
+				}
+			}
+			line = line[start+len(l.BlockStart):]
+			open = true
+		} else {
+			end := strings.Index(line, l.BlockEnd)
+			if end < 0 {
+				return true
+			}
+			line = line[end+len(l.BlockEnd):]
+			open = false
+		}
+	}
+}
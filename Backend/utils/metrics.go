@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"go/types"
+	"math"
+	"sort"
+)
+
+// PackageMetrics contains the package design metrics described by Robert C. Martin.
+// Coupling only counts dependencies between the loaded packages.
+type PackageMetrics struct {
+	Package          string   `json:"package"`
+	AfferentCoupling int      `json:"afferentCoupling"`
+	EfferentCoupling int      `json:"efferentCoupling"`
+	Instability      float64  `json:"instability"`
+	Abstractness     float64  `json:"abstractness"`
+	Distance         float64  `json:"distance"`
+	ExportedTypes    int      `json:"exportedTypes"`
+	Interfaces       int      `json:"interfaces"`
+	Dependents       []string `json:"dependents"`
+	Dependencies     []string `json:"dependencies"`
+}
+
+// FunctionMetrics contains the number of distinct callers and callees of a function
+type FunctionMetrics struct {
+	Function string `json:"function"`
+	Package  string `json:"package"`
+	FanIn    int    `json:"fanIn"`
+	FanOut   int    `json:"fanOut"`
+}
+
+// DesignMetrics groups the package and function level metrics of a project
+type DesignMetrics struct {
+	Packages  []PackageMetrics  `json:"packages"`
+	Functions []FunctionMetrics `json:"functions"`
+}
+
+// roundMetric rounds a ratio to two decimals
+func roundMetric(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// DesignMetrics computes coupling, instability, abstractness and distance from the
+// main sequence for every loaded package, and fan-in/fan-out for every function
+func (ca *CallGraphAnalyzer) DesignMetrics() DesignMetrics {
+	dependencies := make(map[string]map[string]bool)
+	dependents := make(map[string]map[string]bool)
+	for _, pkgPath := range ca.PackagePaths() {
+		dependencies[pkgPath] = make(map[string]bool)
+		dependents[pkgPath] = make(map[string]bool)
+	}
+
+	for _, edge := range ca.ImportEdges() {
+		if _, loaded := ca.pkgs[edge.To]; !loaded || edge.From == edge.To {
+			continue
+		}
+		dependencies[edge.From][edge.To] = true
+		dependents[edge.To][edge.From] = true
+	}
+
+	metrics := DesignMetrics{
+		Packages:  []PackageMetrics{},
+		Functions: []FunctionMetrics{},
+	}
+
+	for _, pkgPath := range ca.PackagePaths() {
+		pm := PackageMetrics{
+			Package:          pkgPath,
+			AfferentCoupling: len(dependents[pkgPath]),
+			EfferentCoupling: len(dependencies[pkgPath]),
+			Dependents:       sortedKeys(dependents[pkgPath]),
+			Dependencies:     sortedKeys(dependencies[pkgPath]),
+		}
+
+		if pkg := ca.pkgs[pkgPath]; pkg.Types != nil {
+			scope := pkg.Types.Scope()
+			for _, name := range scope.Names() {
+				typeName, ok := scope.Lookup(name).(*types.TypeName)
+				if !ok || !typeName.Exported() {
+					continue
+				}
+				pm.ExportedTypes++
+				if types.IsInterface(typeName.Type()) {
+					pm.Interfaces++
+				}
+			}
+		}
+
+		if coupling := pm.AfferentCoupling + pm.EfferentCoupling; coupling > 0 {
+			pm.Instability = roundMetric(float64(pm.EfferentCoupling) / float64(coupling))
+		}
+		if pm.ExportedTypes > 0 {
+			pm.Abstractness = roundMetric(float64(pm.Interfaces) / float64(pm.ExportedTypes))
+		}
+		pm.Distance = roundMetric(math.Abs(pm.Abstractness + pm.Instability - 1))
+
+		metrics.Packages = append(metrics.Packages, pm)
+	}
+
+	snapshot := newCallGraphSnapshot(ca)
+	for _, name := range ca.Functions() {
+		metrics.Functions = append(metrics.Functions, FunctionMetrics{
+			Function: name,
+			Package:  ca.functionNodes[name].Package,
+			FanIn:    snapshot.fanIn[name],
+			FanOut:   snapshot.fanOut[name],
+		})
+	}
+
+	return metrics
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// OwnershipShare represents the share of a function's lines last changed by one author
+type OwnershipShare struct {
+	Name  string  `json:"name"`
+	Email string  `json:"email"`
+	Lines int     `json:"lines"`
+	Pct   float64 `json:"percentage"`
+}
+
+// FunctionOwnership describes who owns a function according to git blame
+type FunctionOwnership struct {
+	PrimaryAuthor string           `json:"primaryAuthor"`
+	PrimaryEmail  string           `json:"primaryEmail"`
+	Contributors  []OwnershipShare `json:"contributors"`
+	LastCommit    GitCommit        `json:"lastCommit"`
+	AgeDays       int              `json:"ageDays"`
+}
+
+// FunctionOwner pairs a function with its ownership
+type FunctionOwner struct {
+	FunctionSpan
+	Ownership *FunctionOwnership `json:"ownership"`
+}
+
+// ComputeOwnership maps the blame of a file onto the line range of a function.
+// It returns nil when no blamed line falls inside the range.
+func ComputeOwnership(blame []BlameLine, startLine, endLine int, now time.Time) *FunctionOwnership {
+	shares := make(map[string]*OwnershipShare)
+	var last *BlameLine
+	total := 0
+
+	for i := range blame {
+		line := &blame[i]
+		if line.Line < startLine || line.Line > endLine {
+			continue
+		}
+		total++
+
+		share, ok := shares[line.Email]
+		if !ok {
+			share = &OwnershipShare{Name: line.Author, Email: line.Email}
+			shares[line.Email] = share
+		}
+		share.Lines++
+
+		if last == nil || line.AuthorTime.After(last.AuthorTime) {
+			last = line
+		}
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	ownership := &FunctionOwnership{
+		Contributors: make([]OwnershipShare, 0, len(shares)),
+		LastCommit: GitCommit{
+			Hash:    last.Commit,
+			Author:  last.Author,
+			Email:   last.Email,
+			Date:    last.AuthorTime.Format(time.RFC3339),
+			Message: last.Summary,
+		},
+		AgeDays: int(now.Sub(last.AuthorTime).Hours() / 24),
+	}
+
+	for _, share := range shares {
+		share.Pct = math.Round(float64(share.Lines) / float64(total) * 100)
+		ownership.Contributors = append(ownership.Contributors, *share)
+	}
+	sort.Slice(ownership.Contributors, func(i, j int) bool {
+		if ownership.Contributors[i].Lines != ownership.Contributors[j].Lines {
+			return ownership.Contributors[i].Lines > ownership.Contributors[j].Lines
+		}
+		return ownership.Contributors[i].Email < ownership.Contributors[j].Email
+	})
+
+	ownership.PrimaryAuthor = ownership.Contributors[0].Name
+	ownership.PrimaryEmail = ownership.Contributors[0].Email
+
+	return ownership
+}
@@ -0,0 +1,286 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/types"
+	"maps"
+	"os"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ErrImportsChanged is returned by ReloadPackages when a reloaded package imports a
+// package that was not loaded before, which takes a full load to type-check
+var ErrImportsChanged = errors.New("imports changed, the packages need a full load")
+
+// ReloadPackages returns a copy of the analyzer in which the packages in dirs and every
+// loaded package importing them, directly or not, are type-checked again. Directories
+// that are new get loaded and those without Go files anymore are dropped. The analyzer
+// itself is left untouched so it can keep serving requests meanwhile. The import paths
+// of the reloaded packages are returned.
+//
+// Only the reloaded packages are parsed. They are type-checked against the already
+// loaded instances of the packages they import, so types and positions stay shared
+// with the packages that were not reloaded.
+func (ca *CallGraphAnalyzer) ReloadPackages(ctx context.Context, dirs []string) (*CallGraphAnalyzer, []string, error) {
+	// Files replaced by the previous reload are no longer served by anyone
+	for _, file := range ca.retired {
+		ca.fset.RemoveFile(file)
+	}
+
+	reloaded := &CallGraphAnalyzer{
+		fset:          ca.fset,
+		pkgs:          maps.Clone(ca.pkgs),
+		functionNodes: maps.Clone(ca.functionNodes),
+		moduleName:    ca.moduleName,
+		rootDir:       ca.rootDir,
+		pathToPackage: maps.Clone(ca.pathToPackage),
+	}
+
+	affected := ca.dependents(dirs)
+	patterns := []string{}
+	for _, dir := range dirs {
+		if _, known := ca.pathToPackage[dir]; !known {
+			patterns = append(patterns, dir)
+		}
+	}
+	for pkgPath := range affected {
+		patterns = append(patterns, ca.pkgs[pkgPath].Dir)
+	}
+
+	// Forget the affected packages, then load those still on disk again
+	for name, node := range reloaded.functionNodes {
+		if affected[node.Package] {
+			delete(reloaded.functionNodes, name)
+		}
+	}
+	for pkgPath := range affected {
+		pkg := ca.pkgs[pkgPath]
+		for _, file := range pkg.Syntax {
+			if tokenFile := ca.fset.File(file.Pos()); tokenFile != nil {
+				reloaded.retired = append(reloaded.retired, tokenFile)
+			}
+		}
+		delete(reloaded.pathToPackage, pkg.Dir)
+		delete(reloaded.pkgs, pkgPath)
+	}
+
+	existing := []string{}
+	for _, dir := range patterns {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			existing = append(existing, dir)
+		}
+	}
+	if len(existing) > 0 {
+		pkgs, err := ca.checkPackages(ctx, existing)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, pkg := range pkgs {
+			reloaded.pathToPackage[pkg.Dir] = pkg.PkgPath
+			reloaded.pkgs[pkg.PkgPath] = pkg
+			reloaded.registerFunctions(pkg)
+			affected[pkg.PkgPath] = true
+		}
+	}
+
+	roots := make([]*packages.Package, 0, len(reloaded.pkgs))
+	for _, pkg := range reloaded.pkgs {
+		roots = append(roots, pkg)
+	}
+	reloaded.loadErrors = collectLoadErrors(roots)
+
+	pkgPaths := make([]string, 0, len(affected))
+	for pkgPath := range affected {
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
+	return reloaded, pkgPaths, nil
+}
+
+// checkPackages parses and type-checks the packages in dirs, resolving their imports
+// to the loaded packages. Packages in dirs importing each other are checked in
+// dependency order. ErrImportsChanged is returned if any other import is missing.
+func (ca *CallGraphAnalyzer) checkPackages(ctx context.Context, dirs []string) ([]*packages.Package, error) {
+	// Listing the files and imports is cheap compared to a load with dependencies
+	config := ca.loadConfig(ctx, ca.rootDir)
+	config.Mode = packages.NeedName |
+		packages.NeedFiles |
+		packages.NeedCompiledGoFiles |
+		packages.NeedImports |
+		packages.NeedTypesSizes
+	listed, err := packages.Load(config, dirs...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading packages: %v", err)
+	}
+
+	loaded := make(map[string]*packages.Package)
+	roots := make([]*packages.Package, 0, len(ca.pkgs))
+	for _, pkg := range ca.pkgs {
+		roots = append(roots, pkg)
+	}
+	packages.Visit(roots, nil, func(pkg *packages.Package) {
+		loaded[pkg.ID] = pkg
+	})
+
+	pending := make(map[string]*packages.Package)
+	for _, pkg := range listed {
+		pending[pkg.ID] = pkg
+	}
+	for _, pkg := range listed {
+		for _, imported := range pkg.Imports {
+			if pending[imported.ID] == nil && loaded[imported.ID] == nil && imported.ID != "unsafe" {
+				return nil, ErrImportsChanged
+			}
+		}
+	}
+
+	checked := make(map[string]*packages.Package)
+	var check func(pkg *packages.Package) error
+	check = func(pkg *packages.Package) error {
+		if _, done := checked[pkg.ID]; done {
+			if checked[pkg.ID] == nil {
+				return fmt.Errorf("import cycle through %s", pkg.PkgPath)
+			}
+			return nil
+		}
+		checked[pkg.ID] = nil
+
+		imports := make(map[string]*packages.Package)
+		for importPath, imported := range pkg.Imports {
+			switch {
+			case pending[imported.ID] != nil:
+				if err := check(pending[imported.ID]); err != nil {
+					return err
+				}
+				imports[importPath] = checked[imported.ID]
+			case loaded[imported.ID] != nil:
+				imports[importPath] = loaded[imported.ID]
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		checked[pkg.ID] = ca.checkPackage(pkg, imports)
+		return nil
+	}
+	for _, pkg := range listed {
+		if err := check(pkg); err != nil {
+			return nil, err
+		}
+	}
+
+	pkgs := make([]*packages.Package, 0, len(listed))
+	for _, pkg := range listed {
+		pkgs = append(pkgs, checked[pkg.ID])
+	}
+	return pkgs, nil
+}
+
+// checkPackage parses the files of a listed package and type-checks them against the
+// given imports, keyed by import path, like packages.Load would
+func (ca *CallGraphAnalyzer) checkPackage(listed *packages.Package, imports map[string]*packages.Package) *packages.Package {
+	pkg := *listed
+	pkg.Fset = ca.fset
+	pkg.Imports = imports
+	pkg.Errors = append([]packages.Error{}, listed.Errors...)
+	pkg.Syntax = []*ast.File{}
+
+	for _, filename := range pkg.CompiledGoFiles {
+		file, err := parser.ParseFile(ca.fset, filename, nil, parser.AllErrors|parser.ParseComments)
+		if file != nil {
+			pkg.Syntax = append(pkg.Syntax, file)
+		}
+		var errorList scanner.ErrorList
+		if errors.As(err, &errorList) {
+			for _, parseErr := range errorList {
+				pkg.Errors = append(pkg.Errors, packages.Error{Pos: parseErr.Pos.String(), Msg: parseErr.Msg, Kind: packages.ParseError})
+			}
+		} else if err != nil {
+			pkg.Errors = append(pkg.Errors, packages.Error{Msg: err.Error(), Kind: packages.ParseError})
+		}
+	}
+
+	pkg.TypesInfo = &types.Info{
+		Types:        make(map[ast.Expr]types.TypeAndValue),
+		Defs:         make(map[*ast.Ident]types.Object),
+		Uses:         make(map[*ast.Ident]types.Object),
+		Implicits:    make(map[ast.Node]types.Object),
+		Instances:    make(map[*ast.Ident]types.Instance),
+		Scopes:       make(map[ast.Node]*types.Scope),
+		Selections:   make(map[*ast.SelectorExpr]*types.Selection),
+		FileVersions: make(map[*ast.File]string),
+	}
+	config := &types.Config{
+		Importer: importerFunc(func(importPath string) (*types.Package, error) {
+			if importPath == "unsafe" {
+				return types.Unsafe, nil
+			}
+			imported, ok := imports[importPath]
+			if !ok || imported.Types == nil {
+				return nil, fmt.Errorf("package %s not loaded", importPath)
+			}
+			return imported.Types, nil
+		}),
+		Sizes: pkg.TypesSizes,
+		Error: func(err error) {
+			if typeErr, ok := err.(types.Error); ok {
+				pkg.Errors = append(pkg.Errors, packages.Error{
+					Pos:  typeErr.Fset.Position(typeErr.Pos).String(),
+					Msg:  typeErr.Msg,
+					Kind: packages.TypeError,
+				})
+				return
+			}
+			pkg.Errors = append(pkg.Errors, packages.Error{Msg: err.Error(), Kind: packages.TypeError})
+		},
+	}
+	pkg.Types, _ = config.Check(pkg.PkgPath, ca.fset, pkg.Syntax, pkg.TypesInfo)
+	pkg.IllTyped = len(pkg.Errors) > 0
+	return &pkg
+}
+
+// importerFunc adapts a function to types.Importer
+type importerFunc func(path string) (*types.Package, error)
+
+// Import imports a package by its path
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// dependents returns the loaded packages in dirs along with every loaded package that
+// imports one of them, directly or not
+func (ca *CallGraphAnalyzer) dependents(dirs []string) map[string]bool {
+	importers := make(map[string][]string)
+	for pkgPath, pkg := range ca.pkgs {
+		for imported := range pkg.Imports {
+			importers[imported] = append(importers[imported], pkgPath)
+		}
+	}
+
+	affected := make(map[string]bool)
+	queue := []string{}
+	for _, dir := range dirs {
+		if pkgPath, ok := ca.pathToPackage[dir]; ok && !affected[pkgPath] {
+			affected[pkgPath] = true
+			queue = append(queue, pkgPath)
+		}
+	}
+	for len(queue) > 0 {
+		pkgPath := queue[0]
+		queue = queue[1:]
+		for _, importer := range importers[pkgPath] {
+			if !affected[importer] {
+				affected[importer] = true
+				queue = append(queue, importer)
+			}
+		}
+	}
+	return affected
+}
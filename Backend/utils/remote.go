@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kinds of git remotes
+const (
+	RemoteHTTPS = "https"
+	RemoteSSH   = "ssh"
+	RemoteGit   = "git"
+	RemoteFile  = "file"
+	RemoteLocal = "local"
+)
+
+// scpLikeURL matches the scp-like syntax of ssh remotes, such as git@github.com:org/repo.git
+var scpLikeURL = regexp.MustCompile(`^(?:([^@/]+)@)?([^:/]+):(.+)$`)
+
+// RemoteURL is a parsed git remote
+type RemoteURL struct {
+	Raw   string `json:"raw"`
+	Kind  string `json:"kind"`
+	User  string `json:"user,omitempty"`
+	Host  string `json:"host,omitempty"`
+	Port  string `json:"port,omitempty"`
+	Owner string `json:"owner"` // User, organization or group path such as group/subgroup
+	Name  string `json:"name"`  // Repository name without the .git suffix
+}
+
+// ParseRemoteURL parses https, ssh, git and file URLs, scp-like ssh remotes and local
+// paths. Nested GitLab subgroups end up in the owner and a .git suffix is dropped.
+func ParseRemoteURL(raw string) (RemoteURL, error) {
+	remote := RemoteURL{Raw: raw}
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return remote, fmt.Errorf("empty repo URL")
+	}
+
+	var repoPath string
+	switch {
+	case strings.Contains(trimmed, "://"):
+		parsed, err := url.Parse(trimmed)
+		if err != nil {
+			return remote, fmt.Errorf("invalid repo URL %s: %w", raw, err)
+		}
+		switch parsed.Scheme {
+		case "https", "http":
+			remote.Kind = RemoteHTTPS
+		case "ssh", "git+ssh", "ssh+git":
+			remote.Kind = RemoteSSH
+		case "git":
+			remote.Kind = RemoteGit
+		case "file":
+			remote.Kind = RemoteFile
+		default:
+			return remote, fmt.Errorf("unsupported repo URL scheme: %s", parsed.Scheme)
+		}
+		if parsed.User != nil {
+			remote.User = parsed.User.Username()
+		}
+		remote.Host = parsed.Hostname()
+		remote.Port = parsed.Port()
+		repoPath = parsed.Path
+
+	case isLocalPath(trimmed):
+		remote.Kind = RemoteLocal
+		repoPath = filepath.ToSlash(filepath.Clean(trimmed))
+
+	default:
+		match := scpLikeURL.FindStringSubmatch(trimmed)
+		if match == nil {
+			return remote, fmt.Errorf("invalid repo URL: %s", raw)
+		}
+		remote.Kind = RemoteSSH
+		remote.User, remote.Host, repoPath = match[1], match[2], match[3]
+	}
+
+	if remote.Kind != RemoteFile && remote.Kind != RemoteLocal && remote.Host == "" {
+		return remote, fmt.Errorf("repo URL without a host: %s", raw)
+	}
+
+	repoPath = strings.Trim(path.Clean("/"+strings.TrimSuffix(repoPath, "/")), "/")
+	repoPath = strings.TrimSuffix(repoPath, ".git")
+	remote.Owner, remote.Name = path.Split(repoPath)
+	remote.Owner = strings.Trim(remote.Owner, "/")
+	if remote.Name == "" || remote.Name == "." {
+		return remote, fmt.Errorf("repo URL without a repository name: %s", raw)
+	}
+
+	return remote, nil
+}
+
+// RedactURL removes the password or token from the user info of a remote URL, so the
+// URL can be stored or shown. Other remotes are returned unchanged.
+func RedactURL(raw string) string {
+	if !strings.Contains(raw, "://") {
+		return raw
+	}
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.User == nil {
+		return raw
+	}
+	if _, hasPassword := parsed.User.Password(); !hasPassword {
+		return raw
+	}
+	parsed.User = url.User(parsed.User.Username())
+	return parsed.String()
+}
+
+// isLocalPath reports whether a remote is a path on this machine rather than scp-like
+// syntax, which git only assumes when there is no slash before the first colon
+func isLocalPath(remote string) bool {
+	if filepath.IsAbs(remote) || strings.HasPrefix(remote, ".") {
+		return true
+	}
+	colon := strings.Index(remote, ":")
+	return colon < 0 || strings.Contains(remote[:colon], "/")
+}
+
+// FolderName returns the relative directory of a clone, made of the host, the owner path
+// and the repository name as nested directories, so that different remotes never share
+// a directory. Local repositories are placed under _local, which no host name can be,
+// followed by their absolute path.
+func (r RemoteURL) FolderName() string {
+	host := strings.ToLower(r.Host)
+	if r.Port != "" {
+		host += "_" + r.Port
+	}
+	owner := r.Owner
+	switch r.Kind {
+	case RemoteFile:
+		host = "_local"
+	case RemoteLocal:
+		// Relative paths lost their dots when parsed, so they are resolved again
+		host = "_local"
+		if absPath, err := filepath.Abs(strings.TrimSpace(r.Raw)); err == nil {
+			owner = filepath.ToSlash(filepath.Dir(absPath))
+		}
+	}
+
+	parts := []string{host}
+	for _, part := range strings.Split(owner, "/") {
+		if part != "" && part != "." && part != ".." {
+			parts = append(parts, part)
+		}
+	}
+	return path.Join(append(parts, r.Name)...)
+}
+
+// SameRepo reports whether two remotes point to the same repository, whatever the
+// protocol or user they use to reach it
+func (r RemoteURL) SameRepo(other RemoteURL) bool {
+	if (r.Kind == RemoteFile || r.Kind == RemoteLocal) != (other.Kind == RemoteFile || other.Kind == RemoteLocal) {
+		return false
+	}
+	return r.FolderName() == other.FolderName()
+}
+
+// tokenUser returns the user name that git hosts expect along with an access token
+func (r RemoteURL) tokenUser() string {
+	switch {
+	case strings.Contains(r.Host, "gitlab"):
+		return "oauth2"
+	case strings.Contains(r.Host, "bitbucket"):
+		return "x-token-auth"
+	}
+	return "x-access-token"
+}
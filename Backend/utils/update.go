@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RepoUpdate describes how UpdateRepo moved a clone
+type RepoUpdate struct {
+	Ref      string        `json:"ref,omitempty"`
+	Before   string        `json:"before"`
+	After    string        `json:"after"`
+	UpToDate bool          `json:"upToDate"`
+	Commits  []CommitEntry `json:"commits"` // Commits reachable from After but not from Before
+}
+
+// UpdateRepo fetches the remote of a clone and moves it to the latest remote state of
+// the current branch, or to ref when it is set. Remote branches are checked out as a
+// local branch tracking them; tags and commits are checked out detached. The token and
+// ssh key of options authenticate the fetch like they did the clone.
+func UpdateRepo(repoPath, ref string, options CloneOptions) (RepoUpdate, error) {
+	before, err := ResolveRef(repoPath, "HEAD")
+	if err != nil {
+		return RepoUpdate{}, err
+	}
+
+	if err := fetchOrigin(repoPath, options); err != nil {
+		return RepoUpdate{}, err
+	}
+
+	switch {
+	case ref == "":
+		if _, err := execGitCommand(repoPath, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+			return RepoUpdate{}, errors.New("the current branch has no upstream branch, pass a ref to update to")
+		}
+		err = runGitCommand(repoPath, "merge", "--ff-only", "@{upstream}")
+	case isRemoteBranch(repoPath, ref):
+		err = runGitCommand(repoPath, "checkout", "-B", ref, "--track", "origin/"+ref)
+	default:
+		commit, resolveErr := ResolveRef(repoPath, ref)
+		if resolveErr != nil {
+			return RepoUpdate{}, resolveErr
+		}
+		err = runGitCommand(repoPath, "checkout", "--detach", commit)
+	}
+	if err != nil {
+		return RepoUpdate{}, err
+	}
+
+	after, err := ResolveRef(repoPath, "HEAD")
+	if err != nil {
+		return RepoUpdate{}, err
+	}
+
+	update := RepoUpdate{
+		Ref:      ref,
+		Before:   before,
+		After:    after,
+		UpToDate: before == after,
+		Commits:  []CommitEntry{},
+	}
+	if !update.UpToDate {
+		logOutput, err := execGitCommand(repoPath, "log", before+".."+after, "-M", "--raw", "--numstat",
+			"--no-color", "--diff-merges=first-parent", commitLogFormat)
+		if err != nil {
+			return update, fmt.Errorf("failed to get git log: %w", err)
+		}
+		update.Commits = parseCommitLog(logOutput)
+	}
+
+	return update, nil
+}
+
+// isRemoteBranch reports whether origin has a branch named ref
+func isRemoteBranch(repoPath, ref string) bool {
+	_, err := execGitCommand(repoPath, "rev-parse", "--verify", "--quiet", "refs/remotes/origin/"+ref)
+	return err == nil
+}
+
+// fetchOrigin fetches the branches and tags of the origin remote with the credentials
+// of options
+func fetchOrigin(repoPath string, options CloneOptions) error {
+	originURL, err := OriginURL(repoPath)
+	if err != nil {
+		return err
+	}
+	remote, err := ParseRemoteURL(originURL)
+	if err != nil {
+		return err
+	}
+	env, err := cloneEnv(remote, options)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("git", "fetch", "--prune", "--tags", "origin")
+	cmd.Dir = repoPath
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// runGitCommand runs a git command that changes the repository and reports its output on failure
+func runGitCommand(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ClearLintResults removes the golangci-lint results stored in a repository, so the
+// next lint run analyzes the current sources
+func ClearLintResults(repoPath string) error {
+	err := os.Remove(filepath.Join(repoPath, "lint-results.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of file changes
+const (
+	FileCreated  = "created"
+	FileModified = "modified"
+	FileRemoved  = "removed"
+)
+
+// FileStamp identifies a version of a file without reading it
+type FileStamp struct {
+	ModTime time.Time
+	Size    int64
+}
+
+// FileChange is a Go source or module file that changed between two scans
+type FileChange struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+}
+
+// IsModuleFile reports whether a file describes the module rather than a package, so
+// changing it can affect every package
+func IsModuleFile(path string) bool {
+	switch filepath.Base(path) {
+	case "go.mod", "go.sum", "go.work", "go.work.sum":
+		return true
+	}
+	return false
+}
+
+// ScanSourceFiles stamps every Go source and module file under root. Entries for which
+// ignore returns true are skipped, and so are the directories among them.
+func ScanSourceFiles(root string, ignore func(name string) bool) (map[string]FileStamp, error) {
+	stamps := make(map[string]FileStamp)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed while scanning are simply missing from the scan
+			if path != root {
+				return nil
+			}
+			return err
+		}
+		if path != root && ignore != nil && ignore(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !(strings.HasSuffix(path, ".go") || IsModuleFile(path)) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stamps[path] = FileStamp{ModTime: info.ModTime(), Size: info.Size()}
+		return nil
+	})
+	return stamps, err
+}
+
+// DiffFileStamps lists the files created, modified and removed between two scans,
+// sorted by path
+func DiffFileStamps(before, after map[string]FileStamp) []FileChange {
+	changes := []FileChange{}
+	for path, stamp := range after {
+		previous, ok := before[path]
+		switch {
+		case !ok:
+			changes = append(changes, FileChange{Path: path, Op: FileCreated})
+		case !previous.ModTime.Equal(stamp.ModTime) || previous.Size != stamp.Size:
+			changes = append(changes, FileChange{Path: path, Op: FileModified})
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Op: FileRemoved})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// RepoRoot returns the top level directory of the git repository containing path
+func RepoRoot(path string) (string, error) {
+	out, err := execGitCommand(path, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", path)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// ResolveRef returns the full commit SHA that a branch, tag or commit ref points to
+func ResolveRef(repoPath, ref string) (string, error) {
+	out, err := execGitCommand(repoPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown git ref: %s", ref)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// AddWorktree checks out a commit into dir as a detached worktree of the repository
+func AddWorktree(repoPath, commit, dir string) error {
+	cmd := exec.Command("git", "worktree", "add", "--detach", "--force", dir, commit)
+	cmd.Dir = repoPath
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree add failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// RemoveWorktree removes a worktree created with AddWorktree
+func RemoveWorktree(repoPath, dir string) error {
+	if _, err := execGitCommand(repoPath, "worktree", "remove", "--force", dir); err != nil {
+		return fmt.Errorf("git worktree remove failed: %w", err)
+	}
+	return nil
+}
+
+// PruneWorktrees makes a repository forget its worktrees whose directory was deleted
+func PruneWorktrees(repoPath string) error {
+	if _, err := execGitCommand(repoPath, "worktree", "prune"); err != nil {
+		return fmt.Errorf("git worktree prune failed: %w", err)
+	}
+	return nil
+}
+
+// GitRef is a branch or tag and the commit it points to
+type GitRef struct {
+	Name   string `json:"name"`
+	Kind   string `json:"kind"` // branch, remote or tag
+	Commit string `json:"commit"`
+}
+
+// ListRefs lists the local branches, remote branches and tags of a repository
+func ListRefs(repoPath string) ([]GitRef, error) {
+	// Annotated tags are peeled to the commit they tag
+	out, err := execGitCommand(repoPath, "for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(*objectname)",
+		"refs/heads", "refs/remotes", "refs/tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git refs: %w", err)
+	}
+
+	refs := []GitRef{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+
+		ref := GitRef{Commit: fields[1]}
+		if fields[2] != "" {
+			ref.Commit = fields[2]
+		}
+		switch {
+		case strings.HasPrefix(fields[0], "refs/heads/"):
+			ref.Kind, ref.Name = "branch", strings.TrimPrefix(fields[0], "refs/heads/")
+		case strings.HasPrefix(fields[0], "refs/remotes/"):
+			ref.Kind, ref.Name = "remote", strings.TrimPrefix(fields[0], "refs/remotes/")
+		case strings.HasPrefix(fields[0], "refs/tags/"):
+			ref.Kind, ref.Name = "tag", strings.TrimPrefix(fields[0], "refs/tags/")
+		}
+		refs = append(refs, ref)
+	}
+
+	return refs, nil
+}
+
+// CurrentRef returns the branch checked out in a repository, or the commit if HEAD is detached
+func CurrentRef(repoPath string) (string, error) {
+	out, err := execGitCommand(repoPath, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", repoPath)
+	}
+	if ref := strings.TrimSpace(out); ref != "HEAD" {
+		return ref, nil
+	}
+	return ResolveRef(repoPath, "HEAD")
+}
+
+// OriginURL returns the URL of the origin remote of a repository
+func OriginURL(repoPath string) (string, error) {
+	out, err := execGitCommand(repoPath, "remote", "get-url", "origin")
+	if err != nil {
+		return "", fmt.Errorf("no origin remote: %s", repoPath)
+	}
+	return strings.TrimSpace(out), nil
+}